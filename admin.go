@@ -0,0 +1,389 @@
+package fastgocaptcha
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	adminMinTokenLength = 16
+	adminMaxBodySize    = 16 << 10
+)
+
+// AdminConfig 配置管理接口的认证，Token 与 Authorize 至少设置一个，同时设置时两者都要通过
+type AdminConfig struct {
+	// Token 通过 Authorization: Bearer <token> 传递，至少 16 个字符
+	Token string
+	// Authorize 自定义认证，例如检查客户端证书或内网地址
+	Authorize func(r *http.Request) bool
+}
+
+// WithAdmin 开启 AdminHandler
+func WithAdmin(config AdminConfig) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.admin = &config
+	}
+}
+
+func (f *FastGoCaptcha) initAdmin() error {
+	if f.admin == nil {
+		return nil
+	}
+	if f.admin.Token == "" && f.admin.Authorize == nil {
+		return fmt.Errorf("admin token or authorize function is required")
+	}
+	if f.admin.Token != "" && len(f.admin.Token) < adminMinTokenLength {
+		return fmt.Errorf("admin token must be at least %d characters", adminMinTokenLength)
+	}
+	return nil
+}
+
+func (f *FastGoCaptcha) adminAuthorized(r *http.Request) bool {
+	if f.admin.Token != "" {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(f.admin.Token)) != 1 {
+			return false
+		}
+	}
+	return f.admin.Authorize == nil || f.admin.Authorize(r)
+}
+
+// checkAdmin 检查管理接口是否开启以及请求是否通过认证，未通过时写入 404 或 401 并返回 false
+func (f *FastGoCaptcha) checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if f.admin == nil {
+		f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "not found"))
+		return false
+	}
+	if !f.adminAuthorized(r) {
+		f.logWarning("admin: unauthorized request", "client_ip", clientIP(r), "path", r.URL.Path)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fastgocaptcha"`)
+		f.writeError(w, r, newError(http.StatusUnauthorized, ErrUnauthorized, "unauthorized"))
+		return false
+	}
+	return true
+}
+
+// SessionInfo 是管理接口中的会话状态
+type SessionInfo struct {
+	ID        string              `json:"id"`
+	CreatedAt time.Time           `json:"created_at"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	Paths     []PathedSessionInfo `json:"paths"`
+}
+
+// PathedSessionInfo 是会话在某个验证范围上的状态
+type PathedSessionInfo struct {
+	// Key 是验证范围，例如 /article/1、matcher:/article/*、group:admin、site:
+	Key       string `json:"key"`
+	Path      string `json:"path"`
+	CaptchaID string `json:"captcha_id,omitempty"`
+	Verified  bool   `json:"verified"`
+	// AllowedTimes 是剩余的一次性通过次数
+	AllowedTimes     int        `json:"allowed_times"`
+	VerifiedUntil    *time.Time `json:"verified_until,omitempty"`
+	FingerprintBound bool       `json:"fingerprint_bound"`
+	// StashedMethod 是等待验证后重放的请求方法
+	StashedMethod string `json:"stashed_method,omitempty"`
+}
+
+// MatcherInfo 是管理接口中的保护规则
+type MatcherInfo struct {
+	Route   string       `json:"route"`
+	Timeout Duration     `json:"timeout"`
+	Scope   ProtectScope `json:"scope"`
+	Group   string       `json:"group,omitempty"`
+}
+
+func (f *FastGoCaptcha) sessionInfo(session *FastGoCaptchaSession) SessionInfo {
+	session.mutex.Lock()
+	expiresAt := session.expiresAt
+	session.mutex.Unlock()
+	info := SessionInfo{
+		ID:        session.id,
+		CreatedAt: session.createdAt,
+		ExpiresAt: expiresAt,
+		Paths:     []PathedSessionInfo{},
+	}
+	now := time.Now()
+	session.pathed.Range(func(key, value any) bool {
+		pathedSession, ok := value.(*PathedSession)
+		if !ok {
+			return true
+		}
+		pathedSession.mutex.Lock()
+		defer pathedSession.mutex.Unlock()
+		p := PathedSessionInfo{
+			Key:              fmt.Sprint(key),
+			Path:             pathedSession.path,
+			CaptchaID:        pathedSession.captchaID,
+			AllowedTimes:     pathedSession.captchaAllowedTimes,
+			FingerprintBound: pathedSession.fingerprint != "",
+		}
+		if pathedSession.captchaExpiredAt.After(now) {
+			verifiedUntil := pathedSession.captchaExpiredAt
+			p.VerifiedUntil = &verifiedUntil
+		}
+		p.Verified = p.AllowedTimes > 0 || p.VerifiedUntil != nil
+		if pathedSession.stashed != nil {
+			p.StashedMethod = pathedSession.stashed.method
+		}
+		info.Paths = append(info.Paths, p)
+		return true
+	})
+	sort.Slice(info.Paths, func(i, j int) bool {
+		return info.Paths[i].Key < info.Paths[j].Key
+	})
+	return info
+}
+
+// Sessions 返回所有未过期的会话
+func (f *FastGoCaptcha) Sessions() []SessionInfo {
+	now := time.Now()
+	sessions := []SessionInfo{}
+	f.sessionManager.Range(func(key, value any) bool {
+		if session, ok := value.(*FastGoCaptchaSession); ok && !session.expired(now) {
+			sessions = append(sessions, f.sessionInfo(session))
+		}
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// RevokeSession 删除会话，该会话的所有验证状态立即失效
+func (f *FastGoCaptcha) RevokeSession(id string) bool {
+	_, ok := f.sessionManager.LoadAndDelete(id)
+	if ok {
+		f.logInfo("revoke session", "session_id", f.hashSessionID(id))
+	}
+	return ok
+}
+
+// RevokeAllSessions 删除所有会话，返回删除的数量
+func (f *FastGoCaptcha) RevokeAllSessions() int {
+	var revoked int
+	f.sessionManager.Range(func(key, value any) bool {
+		if _, ok := f.sessionManager.LoadAndDelete(key); ok {
+			revoked++
+		}
+		return true
+	})
+	f.logInfo("revoke all sessions", "count", revoked)
+	return revoked
+}
+
+// Matchers 返回当前的保护规则，带 / 和不带 / 的两条展开规则合并为一条
+func (f *FastGoCaptcha) Matchers() []MatcherInfo {
+	f.matcherMutex.RLock()
+	defer f.matcherMutex.RUnlock()
+	seen := make(map[string]bool)
+	matchers := []MatcherInfo{}
+	for _, matcher := range f.matchers {
+		if seen[matcher.rawRoute] {
+			continue
+		}
+		seen[matcher.rawRoute] = true
+		matchers = append(matchers, MatcherInfo{
+			Route:   matcher.rawRoute,
+			Timeout: Duration(matcher.timeout),
+			Scope:   f.matcherScope(matcher),
+			Group:   matcher.group,
+		})
+	}
+	sort.Slice(matchers, func(i, j int) bool {
+		return matchers[i].Route < matchers[j].Route
+	})
+	return matchers
+}
+
+// outstandingCaptchas 返回内置存储中的验证码数量，使用自定义存储时返回 -1
+func (f *FastGoCaptcha) outstandingCaptchas() int {
+	if f.captchaStore == nil {
+		return -1
+	}
+	var count int
+	f.captchaStore.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// addMatcherFromConfig 校验并添加一条保护规则，与配置文件中的 routes 格式相同
+func (f *FastGoCaptcha) addMatcherFromConfig(route FastGoCaptchaRouteConfig) error {
+	compiled, err := (&FastGoCaptchaConfig{Routes: []FastGoCaptchaRouteConfig{route}}).compile()
+	if err != nil {
+		return err
+	}
+	f.matcherMutex.Lock()
+	if f.matchers == nil {
+		f.matchers = make(map[string]*FastGoCaptchaMatcher)
+	}
+	for key, matcher := range compiled.matchers {
+		f.matchers[key] = matcher
+	}
+	f.matcherMutex.Unlock()
+	f.logInfo("admin: add protect matcher", "matcher", route.Route, "timeout", time.Duration(route.Timeout))
+	return nil
+}
+
+// removeMatcherRoute 删除一条规则及其展开的规则，返回是否存在
+func (f *FastGoCaptcha) removeMatcherRoute(rawRoute string) bool {
+	f.matcherMutex.Lock()
+	defer f.matcherMutex.Unlock()
+	var removed bool
+	for key, matcher := range f.matchers {
+		if matcher.rawRoute == rawRoute {
+			delete(f.matchers, key)
+			removed = true
+		}
+	}
+	if removed {
+		f.logInfo("admin: remove protect matcher", "matcher", rawRoute)
+	}
+	return removed
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func decodeAdminJSON(w http.ResponseWriter, r *http.Request, v any) *captchaError {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, adminMaxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return bodyError(err, fmt.Sprintf("invalid json body: %v", err))
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return newError(http.StatusBadRequest, ErrMalformed, "unexpected data after json body")
+	}
+	return nil
+}
+
+type adminBanRequest struct {
+	Network  string   `json:"network"`
+	Duration Duration `json:"duration"`
+	Reason   string   `json:"reason"`
+}
+
+// AdminHandler 提供运行时管理接口，需要先通过 WithAdmin 开启，否则所有请求返回 404。
+// 接口路径相对于挂载位置，例如 mux.Handle("/captcha-admin/", http.StripPrefix("/captcha-admin", captcha.AdminHandler()))：
+//
+//	GET    /sessions               列出会话及各路径的验证状态
+//	GET    /sessions/{id}          查看单个会话
+//	DELETE /sessions/{id}          撤销会话
+//	DELETE /sessions               撤销所有会话
+//	GET    /captchas               未使用的验证码数量
+//	GET    /stats                  最近 StatsWindow 内的统计，见 Stats
+//	GET    /matchers               列出保护规则
+//	POST   /matchers               添加规则，body 与配置文件 routes 中的一项相同
+//	DELETE /matchers?route=<route> 删除规则
+//	GET    /bans                   列出封禁
+//	POST   /bans                   封禁 {"network": "203.0.113.0/24", "duration": "1h", "reason": "..."}
+//	DELETE /bans?network=<network> 解除封禁
+//
+// 通过 API 添加的规则在配置文件重新加载后保留，与配置文件中同名的规则除外；
+// 通过 API 删除的规则如果仍在配置文件中，会在下次重新加载时恢复
+func (f *FastGoCaptcha) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, f.Sessions())
+	})
+	mux.HandleFunc("GET /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := f.sessionManager.Load(r.PathValue("id"))
+		session, _ := raw.(*FastGoCaptchaSession)
+		if !ok || session == nil || session.expired(time.Now()) {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrSessionNotFound, "session not found"))
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, f.sessionInfo(session))
+	})
+	mux.HandleFunc("DELETE /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !f.RevokeSession(r.PathValue("id")) {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrSessionNotFound, "session not found"))
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]any{"success": true, "revoked": 1})
+	})
+	mux.HandleFunc("DELETE /sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, map[string]any{"success": true, "revoked": f.RevokeAllSessions()})
+	})
+	mux.HandleFunc("GET /captchas", func(w http.ResponseWriter, r *http.Request) {
+		result := map[string]any{"outstanding": nil}
+		if count := f.outstandingCaptchas(); count >= 0 {
+			result["outstanding"] = count
+		}
+		writeAdminJSON(w, http.StatusOK, result)
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, f.Stats())
+	})
+	mux.HandleFunc("GET /matchers", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, f.Matchers())
+	})
+	mux.HandleFunc("POST /matchers", func(w http.ResponseWriter, r *http.Request) {
+		var route FastGoCaptchaRouteConfig
+		if e := decodeAdminJSON(w, r, &route); e != nil {
+			f.writeError(w, r, e)
+			return
+		}
+		if err := f.addMatcherFromConfig(route); err != nil {
+			f.writeError(w, r, newError(http.StatusBadRequest, ErrMalformed, "%v", err))
+			return
+		}
+		writeAdminJSON(w, http.StatusCreated, map[string]any{"success": true})
+	})
+	mux.HandleFunc("DELETE /matchers", func(w http.ResponseWriter, r *http.Request) {
+		if !f.removeMatcherRoute(r.URL.Query().Get("route")) {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "matcher not found"))
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]any{"success": true})
+	})
+	mux.HandleFunc("GET /bans", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, f.Bans())
+	})
+	mux.HandleFunc("POST /bans", func(w http.ResponseWriter, r *http.Request) {
+		var req adminBanRequest
+		if e := decodeAdminJSON(w, r, &req); e != nil {
+			f.writeError(w, r, e)
+			return
+		}
+		ban, err := f.Ban(req.Network, time.Duration(req.Duration), req.Reason)
+		if err != nil {
+			f.writeError(w, r, newError(http.StatusBadRequest, ErrMalformed, "%v", err))
+			return
+		}
+		writeAdminJSON(w, http.StatusCreated, ban)
+	})
+	mux.HandleFunc("DELETE /bans", func(w http.ResponseWriter, r *http.Request) {
+		if !f.Unban(r.URL.Query().Get("network")) {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "ban not found"))
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]any{"success": true})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.checkAdmin(w, r) {
+			return
+		}
+		if _, pattern := mux.Handler(r); pattern == "" {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "not found"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,349 @@
+package fastgocaptcha
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditIPMode 决定审计记录中客户端 IP 的匿名化方式
+type AuditIPMode string
+
+const (
+	// AuditIPPrefix 只记录 IP 所在网段，默认 IPv4 /24、IPv6 /48
+	AuditIPPrefix AuditIPMode = ""
+	// AuditIPFull 记录完整 IP
+	AuditIPFull AuditIPMode = "full"
+	// AuditIPHash 记录 IP 的 HMAC-SHA256，可以关联同一客户端但无法还原
+	AuditIPHash AuditIPMode = "hash"
+	// AuditIPOmit 不记录 IP
+	AuditIPOmit AuditIPMode = "omit"
+)
+
+// AuditRecord 是一条验证决策记录
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Type      EventType `json:"type"`
+	Method    string    `json:"method,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Matcher   string    `json:"matcher,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	// SessionID 是会话 ID 的 HMAC，会话 ID 同时是 cookie 的值，不会原样写入
+	SessionID string `json:"session_id,omitempty"`
+	CaptchaID string `json:"captcha_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// LatencyMS 是签发到提交的耗时（毫秒），只在校验记录中出现
+	LatencyMS int64 `json:"latency_ms,omitempty"`
+}
+
+// AuditSink 接收审计记录，实现需要并发安全
+type AuditSink interface {
+	WriteAudit(record *AuditRecord) error
+}
+
+// AuditConfig 配置审计日志，零值字段使用默认值
+type AuditConfig struct {
+	// Sink 实现了 io.Closer 时由 FastGoCaptcha.Close 关闭，NewFastGoCaptcha 返回错误时也会关闭
+	Sink AuditSink
+	IP   AuditIPMode
+	// IPv4PrefixLen/IPv6PrefixLen 在 AuditIPPrefix 下使用，默认 24 和 48
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+	// HashKey 是 AuditIPHash 和会话 ID 哈希使用的密钥，为空时随机生成，重启后同一 IP 或会话的哈希会变化
+	HashKey []byte
+	// UserAgent 记录 User-Agent
+	UserAgent bool
+}
+
+// auditedEvents 是写入审计日志的决策事件，会话的创建和过期不属于决策
+var auditedEvents = map[EventType]bool{
+	EventChallengeIssued: true,
+	EventVerifySuccess:   true,
+	EventVerifyFailure:   true,
+	EventBypass:          true,
+	EventRateLimited:     true,
+	EventBanned:          true,
+}
+
+// WithAudit 把保护中间件和校验接口的决策写入审计日志
+func WithAudit(config AuditConfig) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.audit = &config
+	}
+}
+
+// closeAudit 关闭实现了 io.Closer 的审计输出
+func (f *FastGoCaptcha) closeAudit() error {
+	if f.audit == nil {
+		return nil
+	}
+	if closer, ok := f.audit.Sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (f *FastGoCaptcha) initAudit() error {
+	if f.audit == nil {
+		return nil
+	}
+	c := f.audit
+	if c.Sink == nil {
+		return fmt.Errorf("audit sink is required")
+	}
+	switch c.IP {
+	case AuditIPPrefix, AuditIPFull, AuditIPHash, AuditIPOmit:
+	default:
+		return fmt.Errorf("invalid audit ip mode: %s", c.IP)
+	}
+	if c.IPv4PrefixLen == 0 {
+		c.IPv4PrefixLen = 24
+	}
+	if c.IPv6PrefixLen == 0 {
+		c.IPv6PrefixLen = 48
+	}
+	if c.IPv4PrefixLen < 0 || c.IPv4PrefixLen > 32 || c.IPv6PrefixLen < 0 || c.IPv6PrefixLen > 128 {
+		return fmt.Errorf("invalid audit ip prefix length: /%d, /%d", c.IPv4PrefixLen, c.IPv6PrefixLen)
+	}
+	if len(c.HashKey) == 0 {
+		c.HashKey = make([]byte, 32)
+		if _, err := rand.Read(c.HashKey); err != nil {
+			return fmt.Errorf("failed to generate audit hash key: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *AuditConfig) anonymizeIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	switch c.IP {
+	case AuditIPFull:
+		return ip
+	case AuditIPHash:
+		return hashValue(c.HashKey, ip)
+	case AuditIPOmit:
+		return ""
+	default:
+		return ipPrefix(ip, c.IPv4PrefixLen, c.IPv6PrefixLen)
+	}
+}
+
+func hashValue(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// initSessionHashKey 准备日志和审计中会话 ID 哈希使用的密钥，开启审计时与 AuditConfig.HashKey 相同，便于关联
+func (f *FastGoCaptcha) initSessionHashKey() error {
+	if f.audit != nil {
+		f.sessionHashKey = f.audit.HashKey
+		return nil
+	}
+	f.sessionHashKey = make([]byte, 32)
+	if _, err := rand.Read(f.sessionHashKey); err != nil {
+		return fmt.Errorf("failed to generate session hash key: %v", err)
+	}
+	return nil
+}
+
+// hashSessionID 返回会话 ID 的 HMAC，会话 ID 就是 cookie 的值，日志和审计记录中只使用哈希
+func (f *FastGoCaptcha) hashSessionID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return hashValue(f.sessionHashKey, id)
+}
+
+// auditEvent 把决策事件写入审计日志，写入失败只记录错误，不影响请求
+func (f *FastGoCaptcha) auditEvent(e *Event) {
+	if f.audit == nil || !auditedEvents[e.Type] {
+		return
+	}
+	record := &AuditRecord{
+		Time:      e.Time.UTC(),
+		Type:      e.Type,
+		Method:    e.Method,
+		Host:      e.Host,
+		Path:      e.Path,
+		Matcher:   e.Matcher,
+		ClientIP:  f.audit.anonymizeIP(e.ClientIP),
+		SessionID: f.hashSessionID(e.SessionID),
+		CaptchaID: e.CaptchaID,
+		Reason:    e.Reason,
+	}
+	if f.audit.UserAgent {
+		record.UserAgent = e.UserAgent
+	}
+	if e.Type == EventVerifySuccess || e.Type == EventVerifyFailure {
+		record.LatencyMS = e.Latency.Milliseconds()
+	}
+	if err := f.audit.Sink.WriteAudit(record); err != nil {
+		f.logError("failed to write audit record", "event", e.Type, "error", err)
+	}
+}
+
+// AuditFileOptions 配置 AuditFileWriter 的轮转
+type AuditFileOptions struct {
+	// MaxSize 文件超过该字节数时轮转，0 表示不按大小轮转
+	MaxSize int64
+	// MaxAge 文件打开超过该时间时轮转，0 表示不按时间轮转
+	MaxAge time.Duration
+	// MaxBackups 保留的轮转文件数量，0 表示全部保留
+	MaxBackups int
+}
+
+// AuditFileWriter 以 JSON Lines 格式追加写入审计记录，轮转后的文件名为 <path>.<UTC 时间>
+type AuditFileWriter struct {
+	path    string
+	options AuditFileOptions
+
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// NewAuditFileWriter 打开（或创建）审计日志文件，已有内容会被保留
+func NewAuditFileWriter(path string, options AuditFileOptions) (*AuditFileWriter, error) {
+	if options.MaxSize < 0 || options.MaxAge < 0 || options.MaxBackups < 0 {
+		return nil, fmt.Errorf("invalid audit file options: %+v", options)
+	}
+	w := &AuditFileWriter{path: path, options: options}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *AuditFileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file %s: %v", w.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit file %s: %v", w.path, err)
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+// WriteAudit 写入一行记录，写入前按大小或时间检查是否需要轮转
+func (w *AuditFileWriter) WriteAudit(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	line = append(line, '\n')
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return fmt.Errorf("audit file %s is closed", w.path)
+	}
+	var rotateErr error
+	if w.shouldRotate(int64(len(line))) {
+		rotateErr = w.rotate()
+		if w.file == nil {
+			return rotateErr
+		}
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit file %s: %v", w.path, err)
+	}
+	// 轮转失败时记录仍然写入了原文件，只报告轮转的错误
+	return rotateErr
+}
+
+func (w *AuditFileWriter) shouldRotate(next int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.options.MaxSize > 0 && w.size+next > w.options.MaxSize {
+		return true
+	}
+	return w.options.MaxAge > 0 && time.Since(w.openedAt) >= w.options.MaxAge
+}
+
+func (w *AuditFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit file %s: %v", w.path, err)
+	}
+	w.file = nil
+	backup := w.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(w.path, backup); err != nil {
+		// 轮转失败时继续写入原文件
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to rotate audit file %s: %v", w.path, err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	return w.removeOldBackups()
+}
+
+func (w *AuditFileWriter) removeOldBackups() error {
+	if w.options.MaxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		if isAuditBackup(strings.TrimPrefix(match, w.path+".")) {
+			backups = append(backups, match)
+		}
+	}
+	if len(backups) <= w.options.MaxBackups {
+		return nil
+	}
+	// 时间戳格式按字典序即按时间排序
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-w.options.MaxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return fmt.Errorf("failed to remove audit backup %s: %v", backup, err)
+		}
+	}
+	return nil
+}
+
+func isAuditBackup(suffix string) bool {
+	_, err := time.Parse("20060102T150405.000000000", suffix)
+	return err == nil
+}
+
+// Close 关闭审计日志文件
+func (w *AuditFileWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
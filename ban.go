@@ -0,0 +1,117 @@
+package fastgocaptcha
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Ban 是一条封禁记录，ExpiresAt 为空表示永久封禁
+type Ban struct {
+	Network   string     `json:"network"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	ipNet *net.IPNet
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && now.After(*b.ExpiresAt)
+}
+
+// Ban 封禁单个 IP 或 CIDR，duration 为 0 表示永久封禁；再次封禁同一网段会覆盖原记录
+func (f *FastGoCaptcha) Ban(ipOrCIDR string, duration time.Duration, reason string) (*Ban, error) {
+	if duration < 0 {
+		return nil, fmt.Errorf("ban duration must not be negative: %v", duration)
+	}
+	ipNet, err := parseAllowIP(ipOrCIDR)
+	if err != nil {
+		return nil, err
+	}
+	ban := &Ban{
+		Network:   ipNet.String(),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+		ipNet:     ipNet,
+	}
+	if duration > 0 {
+		expiresAt := ban.CreatedAt.Add(duration)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	f.banMutex.Lock()
+	if f.bans == nil {
+		f.bans = make(map[string]*Ban)
+	}
+	f.bans[ban.Network] = ban
+	f.banMutex.Unlock()
+	f.logInfo("ban client", "network", ban.Network, "duration", duration, "reason", reason)
+	return ban, nil
+}
+
+// Unban 解除封禁，参数需要与封禁时的网段一致，返回是否存在该封禁
+func (f *FastGoCaptcha) Unban(ipOrCIDR string) bool {
+	ipNet, err := parseAllowIP(ipOrCIDR)
+	if err != nil {
+		return false
+	}
+	f.banMutex.Lock()
+	defer f.banMutex.Unlock()
+	if _, ok := f.bans[ipNet.String()]; !ok {
+		return false
+	}
+	delete(f.bans, ipNet.String())
+	f.logInfo("unban client", "network", ipNet.String())
+	return true
+}
+
+// Bans 返回当前生效的封禁，已过期的记录会被清理
+func (f *FastGoCaptcha) Bans() []Ban {
+	now := time.Now()
+	f.banMutex.Lock()
+	defer f.banMutex.Unlock()
+	bans := make([]Ban, 0, len(f.bans))
+	for network, ban := range f.bans {
+		if ban.expired(now) {
+			delete(f.bans, network)
+			continue
+		}
+		bans = append(bans, *ban)
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].CreatedAt.Before(bans[j].CreatedAt)
+	})
+	return bans
+}
+
+func (f *FastGoCaptcha) isBanned(r *http.Request) bool {
+	f.banMutex.RLock()
+	defer f.banMutex.RUnlock()
+	if len(f.bans) == 0 {
+		return false
+	}
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil {
+		return false
+	}
+	now := time.Now()
+	for _, ban := range f.bans {
+		if !ban.expired(now) && ban.ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectBanned 拒绝被封禁的客户端，返回 true 表示已经响应
+func (f *FastGoCaptcha) rejectBanned(w http.ResponseWriter, r *http.Request) bool {
+	if !f.isBanned(r) {
+		return false
+	}
+	f.emitEvent(r, &Event{Type: EventBanned})
+	f.writeError(w, r, newError(http.StatusForbidden, ErrBanned, "client is banned"))
+	return true
+}
@@ -0,0 +1,363 @@
+package fastgocaptcha
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/wenlng/go-captcha-assets/resources/images"
+	"github.com/wenlng/go-captcha-assets/resources/tiles"
+	"github.com/wenlng/go-captcha/v2/base/codec"
+	"github.com/wenlng/go-captcha/v2/base/option"
+	"github.com/wenlng/go-captcha/v2/slide"
+)
+
+const (
+	defaultCaptchaImageWidth  = 300
+	defaultCaptchaImageHeight = 220
+	defaultCaptchaTileMinSize = 60
+	defaultCaptchaTileMaxSize = 70
+	defaultCaptchaJPEGQuality = 100
+	captchaMinTileSize        = 20
+
+	// 限制自定义图片的文件大小和像素尺寸，图片在启动时全部解码并常驻内存
+	captchaImageMaxFileSize = 8 << 20
+	captchaImageMaxSide     = 4096
+	captchaTileMaxSide      = 1024
+)
+
+// CaptchaImageFormat 是背景图的编码格式，拼图块始终使用 PNG
+type CaptchaImageFormat string
+
+const (
+	CaptchaImageJPEG CaptchaImageFormat = "jpeg"
+	CaptchaImagePNG  CaptchaImageFormat = "png"
+)
+
+// CaptchaImageConfig 配置验证码图片的尺寸、难度和编码，零值字段使用默认值
+type CaptchaImageConfig struct {
+	// Width/Height 是背景图尺寸，默认 300x220，前端组件会按返回的尺寸显示
+	Width  int
+	Height int
+	// TileMinSize/TileMaxSize 是拼图块边长的随机范围，默认 60 到 70
+	TileMinSize int
+	TileMaxSize int
+	// Decoys 是背景上额外绘制的干扰缺口数量，默认 0
+	Decoys int
+	// AlignDecoys 让干扰缺口与真实缺口在同一高度，默认每个缺口的高度随机
+	AlignDecoys bool
+	// Format 默认 CaptchaImageJPEG
+	Format CaptchaImageFormat
+	// JPEGQuality 是 JPEG 编码质量 1-100，默认 100，降低质量可以明显减小响应体积
+	JPEGQuality int
+}
+
+// WithCaptchaImageConfig 设置验证码图片的尺寸、拼图块大小、干扰缺口数量和编码格式
+func WithCaptchaImageConfig(config CaptchaImageConfig) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.captchaImage = config
+	}
+}
+
+func (f *FastGoCaptcha) initCaptchaImage() error {
+	c := &f.captchaImage
+	if c.Width == 0 {
+		c.Width = defaultCaptchaImageWidth
+	}
+	if c.Height == 0 {
+		c.Height = defaultCaptchaImageHeight
+	}
+	if c.TileMinSize == 0 && c.TileMaxSize == 0 {
+		c.TileMinSize, c.TileMaxSize = defaultCaptchaTileMinSize, defaultCaptchaTileMaxSize
+	} else if c.TileMinSize == 0 {
+		c.TileMinSize = c.TileMaxSize
+	} else if c.TileMaxSize == 0 {
+		c.TileMaxSize = c.TileMinSize
+	}
+	if c.Format == "" {
+		c.Format = CaptchaImageJPEG
+	}
+	if c.JPEGQuality == 0 {
+		c.JPEGQuality = defaultCaptchaJPEGQuality
+	}
+
+	if c.Width < 0 || c.Height < 0 || c.Width > captchaImageMaxSide || c.Height > captchaImageMaxSide {
+		return fmt.Errorf("invalid captcha image size %dx%d", c.Width, c.Height)
+	}
+	if c.TileMinSize > c.TileMaxSize {
+		return fmt.Errorf("invalid captcha tile size range %d-%d", c.TileMinSize, c.TileMaxSize)
+	}
+	if c.TileMinSize < captchaMinTileSize {
+		return fmt.Errorf("captcha tile size must be at least %d, got %d", captchaMinTileSize, c.TileMinSize)
+	}
+	if c.Decoys < 0 {
+		return fmt.Errorf("captcha decoys must not be negative: %d", c.Decoys)
+	}
+	// 与 go-captcha 生成缺口的方式一致：缺口不能超出图片，且每个缺口占用的横向区域不能重叠
+	if c.Height < 2*c.TileMaxSize+10 {
+		return fmt.Errorf("captcha image height %d is too small for %dpx tiles, need at least %d", c.Height, c.TileMaxSize, 2*c.TileMaxSize+10)
+	}
+	if minWidth := (c.TileMaxSize+5)*(c.Decoys+1) + c.TileMaxSize + 20; c.Width < minWidth {
+		return fmt.Errorf("captcha image width %d is too small for %dpx tiles and %d decoys, need at least %d", c.Width, c.TileMaxSize, c.Decoys, minWidth)
+	}
+	switch c.Format {
+	case CaptchaImageJPEG, CaptchaImagePNG:
+	default:
+		return fmt.Errorf("invalid captcha image format: %s", c.Format)
+	}
+	if c.JPEGQuality < 1 || c.JPEGQuality > 100 {
+		return fmt.Errorf("captcha jpeg quality must be between 1 and 100, got %d", c.JPEGQuality)
+	}
+	return nil
+}
+
+func (c *CaptchaImageConfig) builderOptions() []slide.Option {
+	return []slide.Option{
+		slide.WithImageSize(option.Size{Width: c.Width, Height: c.Height}),
+		slide.WithRangeGraphSize(option.RangeVal{Min: c.TileMinSize, Max: c.TileMaxSize}),
+		slide.WithGenGraphNumber(c.Decoys + 1),
+		slide.WithEnableGraphVerticalRandom(!c.AlignDecoys),
+	}
+}
+
+// encode 把背景图编码为 data URL
+func (c *CaptchaImageConfig) encode(img image.Image) (string, error) {
+	if c.Format == CaptchaImagePNG {
+		return codec.EncodePNGToBase64(img)
+	}
+	return codec.EncodeJPEGToBase64(img, c.JPEGQuality)
+}
+
+// tile 目录中的文件名与 go-captcha-assets 相同
+const (
+	tileOverlayFile = "tile.png"
+	tileShadowFile  = "tile-shadow.png"
+	tileMaskFile    = "tile-mask.png"
+)
+
+// WithCaptchaImages 从 fsys 加载验证码的背景图和拼图形状，目录结构如下：
+//
+//	backgrounds/*.png|*.jpg|*.jpeg  背景图，不小于图片尺寸（默认 300x220），更大的图片每次随机裁剪一块
+//	tiles/<name>/tile.png           拼图块的叠加图
+//	tiles/<name>/tile-shadow.png    背景上缺口处的阴影
+//	tiles/<name>/tile-mask.png      从背景中裁出拼图块的遮罩
+//
+// 拼图的三张图片必须是尺寸相同的正方形 PNG，边长不小于 TileMaxSize（默认 70）。
+// backgrounds 或 tiles 不存在或为空时使用 go-captcha-assets 的默认资源，
+// fsys 的根目录不存在，或有任何文件格式或尺寸不符合要求时 NewFastGoCaptcha 返回错误
+func WithCaptchaImages(fsys fs.FS) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.captchaImages = fsys
+	}
+}
+
+// WithCaptchaImagesDir 从本地目录加载背景图和拼图形状，见 WithCaptchaImages
+func WithCaptchaImagesDir(dir string) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.captchaImages = os.DirFS(dir)
+		f.captchaImagesDir = dir
+	}
+}
+
+// loadCaptchaResources 加载自定义的背景图和拼图形状，缺少的部分使用默认资源
+func (f *FastGoCaptcha) loadCaptchaResources() ([]image.Image, []*slide.GraphImage, error) {
+	var backgrounds []image.Image
+	var graphs []*slide.GraphImage
+	if f.captchaImages != nil {
+		// 根目录本身不存在通常是路径写错，直接报错而不是悄悄使用默认图片
+		info, err := fs.Stat(f.captchaImages, ".")
+		if err == nil && !info.IsDir() {
+			err = errors.New("not a directory")
+		}
+		if err != nil {
+			if f.captchaImagesDir != "" {
+				return nil, nil, fmt.Errorf("invalid captcha images directory %s: %v", f.captchaImagesDir, err)
+			}
+			return nil, nil, fmt.Errorf("invalid captcha images: %v", err)
+		}
+		backgrounds, err = loadBackgrounds(f.captchaImages, f.captchaImage.Width, f.captchaImage.Height)
+		if err != nil {
+			return nil, nil, err
+		}
+		graphs, err = loadTiles(f.captchaImages, f.captchaImage.TileMaxSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(backgrounds) == 0 && len(graphs) == 0 {
+			f.logWarning("no custom captcha images found, using the default images")
+		} else {
+			f.logInfo("load custom captcha images", "backgrounds", len(backgrounds), "tiles", len(graphs))
+		}
+	}
+
+	if len(backgrounds) == 0 {
+		defaults, err := images.GetImages()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load default captcha backgrounds: %v", err)
+		}
+		for _, background := range defaults {
+			if size := background.Bounds().Size(); size.X < f.captchaImage.Width || size.Y < f.captchaImage.Height {
+				return nil, nil, fmt.Errorf("the default captcha backgrounds are %dx%d, use WithCaptchaImages to provide backgrounds of at least %dx%d",
+					size.X, size.Y, f.captchaImage.Width, f.captchaImage.Height)
+			}
+		}
+		backgrounds = defaults
+	}
+	if len(graphs) == 0 {
+		defaults, err := tiles.GetTiles()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load default captcha tiles: %v", err)
+		}
+		for _, graph := range defaults {
+			graphs = append(graphs, &slide.GraphImage{
+				OverlayImage: graph.OverlayImage,
+				MaskImage:    graph.MaskImage,
+				ShadowImage:  graph.ShadowImage,
+			})
+		}
+	}
+	return backgrounds, graphs, nil
+}
+
+// readDirIfExists 与 fs.ReadDir 相同，目录不存在时返回空，跳过以 . 开头的文件
+func readDirIfExists(fsys fs.FS, dir string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read captcha images %s: %v", dir, err)
+	}
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, nil
+}
+
+func loadBackgrounds(fsys fs.FS, width, height int) ([]image.Image, error) {
+	entries, err := readDirIfExists(fsys, "backgrounds")
+	if err != nil {
+		return nil, err
+	}
+	var backgrounds []image.Image
+	for _, entry := range entries {
+		name := path.Join("backgrounds", entry.Name())
+		if entry.IsDir() {
+			return nil, fmt.Errorf("invalid captcha background %s: unexpected directory", name)
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".png", ".jpg", ".jpeg":
+		default:
+			return nil, fmt.Errorf("invalid captcha background %s: only png and jpeg are supported", name)
+		}
+		img, err := decodeCaptchaImage(fsys, name, captchaImageMaxSide, func(config image.Config, format string) error {
+			if format != "png" && format != "jpeg" {
+				return fmt.Errorf("only png and jpeg are supported, got %s", format)
+			}
+			if config.Width < width || config.Height < height {
+				return fmt.Errorf("image is %dx%d, must be at least %dx%d", config.Width, config.Height, width, height)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		backgrounds = append(backgrounds, img)
+	}
+	return backgrounds, nil
+}
+
+func loadTiles(fsys fs.FS, minSize int) ([]*slide.GraphImage, error) {
+	entries, err := readDirIfExists(fsys, "tiles")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	var graphs []*slide.GraphImage
+	for _, entry := range entries {
+		dir := path.Join("tiles", entry.Name())
+		if !entry.IsDir() {
+			return nil, fmt.Errorf("invalid captcha tile %s: expected a directory with %s, %s and %s", dir, tileOverlayFile, tileShadowFile, tileMaskFile)
+		}
+		var size image.Point
+		load := func(file string) (image.Image, error) {
+			return decodeCaptchaImage(fsys, path.Join(dir, file), captchaTileMaxSide, func(config image.Config, format string) error {
+				if format != "png" {
+					return fmt.Errorf("tile images must be png, got %s", format)
+				}
+				if config.Width != config.Height {
+					return fmt.Errorf("tile image is %dx%d, must be square", config.Width, config.Height)
+				}
+				if config.Width < minSize {
+					return fmt.Errorf("tile image is %dx%d, must be at least %dx%d", config.Width, config.Height, minSize, minSize)
+				}
+				if size != (image.Point{}) && size != image.Pt(config.Width, config.Height) {
+					return fmt.Errorf("tile image is %dx%d, but %s is %dx%d", config.Width, config.Height, tileOverlayFile, size.X, size.Y)
+				}
+				size = image.Pt(config.Width, config.Height)
+				return nil
+			})
+		}
+		overlay, err := load(tileOverlayFile)
+		if err != nil {
+			return nil, err
+		}
+		shadow, err := load(tileShadowFile)
+		if err != nil {
+			return nil, err
+		}
+		mask, err := load(tileMaskFile)
+		if err != nil {
+			return nil, err
+		}
+		graphs = append(graphs, &slide.GraphImage{
+			OverlayImage: overlay,
+			ShadowImage:  shadow,
+			MaskImage:    mask,
+		})
+	}
+	return graphs, nil
+}
+
+// decodeCaptchaImage 先读取图片头检查格式和尺寸，通过 check 后再完整解码
+func decodeCaptchaImage(fsys fs.FS, name string, maxSide int, check func(config image.Config, format string) error) (image.Image, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid captcha image %s: %v", name, err)
+	}
+	if info.Size() > captchaImageMaxFileSize {
+		return nil, fmt.Errorf("invalid captcha image %s: file is larger than %d bytes", name, captchaImageMaxFileSize)
+	}
+	raw, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid captcha image %s: %v", name, err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid captcha image %s: %v", name, err)
+	}
+	if config.Width > maxSide || config.Height > maxSide {
+		return nil, fmt.Errorf("invalid captcha image %s: image is %dx%d, must be at most %dx%d", name, config.Width, config.Height, maxSide, maxSide)
+	}
+	if err := check(config, format); err != nil {
+		return nil, fmt.Errorf("invalid captcha image %s: %v", name, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid captcha image %s: %v", name, err)
+	}
+	return img, nil
+}
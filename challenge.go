@@ -0,0 +1,92 @@
+package fastgocaptcha
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ChallengeResponse 是 API/XHR 客户端收到的结构化验证码挑战
+type ChallengeResponse struct {
+	Success     bool      `json:"success"`
+	Code        ErrorCode `json:"code"`
+	Message     string    `json:"message"`
+	ChallengeID string    `json:"challenge_id"`
+	Path        string    `json:"path"`
+	Scope       string    `json:"scope"`
+	CaptchaURL  string    `json:"captcha_url"`
+	VerifyURL   string    `json:"verify_url"`
+	PageURL     string    `json:"page_url"`
+	// RetryMethod 验证成功后应当重新发送的请求方法
+	RetryMethod string `json:"retry_method"`
+	RetryURL    string `json:"retry_url"`
+}
+
+// WithChallengeStatusCode 设置返回给 API 客户端的挑战状态码，可选 401、403、428（默认）
+func WithChallengeStatusCode(code int) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.challengeStatusCode = code
+	}
+}
+
+// wantsJSONChallenge 判断请求是否来自 API 或 XHR 客户端
+func (f *FastGoCaptcha) wantsJSONChallenge(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest") {
+		return true
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			return false
+		case "application/json", "text/json", "application/x-json":
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FastGoCaptcha) endpointURL(endpoint string, path string) string {
+	u := strings.TrimSuffix(f.requestURIPrefix, "/") + endpoint
+	if path == "" {
+		return u
+	}
+	return u + "?fastgocaptcha_path=" + url.QueryEscape(path)
+}
+
+func (f *FastGoCaptcha) writeJSONChallenge(w http.ResponseWriter, r *http.Request, matcher *FastGoCaptchaMatcher, captchaID string) {
+	var returnTo string
+	if isSafeMethod(r.Method) {
+		returnTo = r.URL.RequestURI()
+	}
+	var scope ProtectScope = ScopePath
+	if matcher != nil {
+		scope = f.matcherScope(matcher)
+	}
+	challenge := &ChallengeResponse{
+		Success:     false,
+		Code:        ErrCaptchaRequired,
+		Message:     "This route requires captcha verification",
+		ChallengeID: captchaID,
+		Path:        r.URL.Path,
+		Scope:       string(scope),
+		CaptchaURL:  f.endpointURL("/fastgocaptcha/captcha", r.URL.Path),
+		VerifyURL:   f.endpointURL("/fastgocaptcha/verify", r.URL.Path),
+		PageURL:     f.challengeURL("/fastgocaptcha/session/captcha", r.URL.Path, returnTo),
+		RetryMethod: r.Method,
+		RetryURL:    r.URL.RequestURI(),
+	}
+	w.Header().Set("X-FastGoCaptcha-Auth", challenge.PageURL)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(f.challengeStatusCode)
+	json.NewEncoder(w).Encode(challenge)
+}
@@ -0,0 +1,190 @@
+package fastgocaptcha
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed resources/challenge.html
+var defaultChallengePage string
+
+var defaultChallengeTemplate = template.Must(template.New("challenge").Parse(defaultChallengePage))
+
+// ChallengeTheme 用于定制挑战页面的品牌和配色
+type ChallengeTheme struct {
+	BrandName       string
+	LogoURL         string
+	PrimaryColor    string
+	BackgroundColor string
+	FontFamily      string
+}
+
+var defaultChallengeTheme = ChallengeTheme{
+	PrimaryColor:    "#4CAF50",
+	BackgroundColor: "#f5f5f5",
+	FontFamily:      "Arial, sans-serif",
+}
+
+// ChallengePageData 是传给挑战页面模板的数据
+type ChallengePageData struct {
+	Locale   string
+	Messages MessageCatalog
+	Theme    ChallengeTheme
+	// Path 是需要验证的原始路径
+	Path string
+	// ReturnURL 是校验过签名的 return_to 地址，验证成功后跳转，为空时停留在当前页面
+	ReturnURL     string
+	CaptchaURL    string
+	VerifyURL     string
+	ScriptURL     string
+	I18nScriptURL string
+	AssetsURL     string
+
+	StyleURL           string
+	ChallengeScriptURL string
+	ChallengeStyleURL  string
+	GoCaptchaScriptURL string
+	GoCaptchaStyleURL  string
+	// Nonce 每个响应不同，用于 <script>/<style> 的 nonce 属性
+	Nonce string
+	// Integrity 内置资源的 SRI 值，key 为资源文件名
+	Integrity map[string]string
+}
+
+// T 返回当前语言下 key 对应的文案，不存在时返回 key 本身
+func (d *ChallengePageData) T(key string) string {
+	if v, ok := d.Messages[key]; ok {
+		return v
+	}
+	return key
+}
+
+// WithChallengePageTemplate 使用自定义 html/template 渲染 /fastgocaptcha/session/captcha，模板数据为 *ChallengePageData
+func WithChallengePageTemplate(tmpl *template.Template) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.challengeTemplate = tmpl
+	}
+}
+
+// WithChallengeTheme 设置默认挑战页面的品牌信息，空字段使用默认值
+func WithChallengeTheme(theme ChallengeTheme) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.challengeTheme = theme
+	}
+}
+
+// WithChallengeAssets 通过 /fastgocaptcha/assets/ 提供自定义静态资源（logo、样式等）
+func WithChallengeAssets(fsys fs.FS) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.challengeAssets = fsys
+	}
+}
+
+func (f *FastGoCaptcha) initChallengePage() {
+	if f.challengeTemplate == nil {
+		f.challengeTemplate = defaultChallengeTemplate
+	}
+	theme := f.challengeTheme
+	if theme.PrimaryColor == "" {
+		theme.PrimaryColor = defaultChallengeTheme.PrimaryColor
+	}
+	if theme.BackgroundColor == "" {
+		theme.BackgroundColor = defaultChallengeTheme.BackgroundColor
+	}
+	if theme.FontFamily == "" {
+		theme.FontFamily = defaultChallengeTheme.FontFamily
+	}
+	f.challengeTheme = theme
+	f.initCatalogs()
+}
+
+func (f *FastGoCaptcha) challengePageData(r *http.Request, nonce string) *ChallengePageData {
+	locale := f.requestLocale(r)
+	path := r.URL.Query().Get("fastgocaptcha_path")
+	returnToToken, returnURL := f.returnToFromQuery(r.URL.Query())
+	verifyURL := f.endpointURL("/fastgocaptcha/verify", path)
+	if returnToToken != "" {
+		verifyURL = appendQuery(verifyURL, "return_to", returnToToken)
+	}
+	prefix := strings.TrimSuffix(f.requestURIPrefix, "/")
+	resources := prefix + "/fastgocaptcha/resources/"
+	return &ChallengePageData{
+		Locale:        locale,
+		Messages:      f.messages(locale),
+		Theme:         f.challengeTheme,
+		Path:          path,
+		ReturnURL:     returnURL,
+		CaptchaURL:    f.endpointURL("/fastgocaptcha/captcha", path),
+		VerifyURL:     verifyURL,
+		ScriptURL:     resources + "fastgocaptcha.js",
+		I18nScriptURL: resources + "fastgocaptcha.i18n.js?lang=" + locale,
+		AssetsURL:     prefix + "/fastgocaptcha/assets/",
+
+		StyleURL:           resources + "fastgocaptcha.css",
+		ChallengeScriptURL: resources + "challenge.js",
+		ChallengeStyleURL:  resources + "challenge.css",
+		GoCaptchaScriptURL: resources + "gocaptcha.global.js",
+		GoCaptchaStyleURL:  resources + "gocaptcha.global.css",
+		Nonce:              nonce,
+		Integrity:          resourceIntegrity,
+	}
+}
+
+func (f *FastGoCaptcha) serveChallengePage(w http.ResponseWriter, r *http.Request) {
+	nonce, err := newNonce()
+	if err != nil {
+		f.logError("failed to generate csp nonce", "error", err)
+		f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to render challenge page"))
+		return
+	}
+	var buf bytes.Buffer
+	if err := f.challengeTemplate.Execute(&buf, f.challengePageData(r, nonce)); err != nil {
+		f.logError("failed to render challenge page", "error", err)
+		f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to render challenge page"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", f.requestLocale(r))
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Cache-Control", "no-store")
+	f.setContentSecurityPolicy(w, nonce)
+	w.Write(buf.Bytes())
+}
+
+// serveI18nScript 输出 window.FastGoCaptchaMessages，fastgocaptcha.js 会优先使用其中的文案
+func (f *FastGoCaptcha) serveI18nScript(w http.ResponseWriter, r *http.Request) {
+	locale := f.requestLocale(r)
+	raw, err := json.Marshal(f.messages(locale))
+	if err != nil {
+		f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to encode messages"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Content-Language", locale)
+	w.Header().Set("Vary", "Accept-Language")
+	w.Write([]byte("window.FastGoCaptchaMessages = "))
+	w.Write(raw)
+	w.Write([]byte(";\n"))
+}
+
+func (f *FastGoCaptcha) serveChallengeAssets(w http.ResponseWriter, r *http.Request, name string) {
+	if f.challengeAssets == nil {
+		http.NotFound(w, r)
+		return
+	}
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+	if info, err := fs.Stat(f.challengeAssets, name); err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, f.challengeAssets, name)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yaklang/fastgocaptcha"
+)
+
+// proxyConfig 是 -config 指定的 JSON 配置文件，保护规则字段与 fastgocaptcha.FastGoCaptchaConfig 相同，
+// 文件变化时保护规则会热更新，其余字段需要重启生效
+type proxyConfig struct {
+	Listen          string                 `json:"listen"`
+	Upstream        string                 `json:"upstream"`
+	TLSCert         string                 `json:"tls_cert"`
+	TLSKey          string                 `json:"tls_key"`
+	PreserveHost    bool                   `json:"preserve_host"`
+	ShutdownTimeout fastgocaptcha.Duration `json:"shutdown_timeout"`
+	DefaultScope    string                 `json:"default_scope"`
+	CaptchaImages   string                 `json:"captcha_images"`
+
+	fastgocaptcha.FastGoCaptchaConfig
+}
+
+func loadProxyConfig(path string) (*proxyConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	var cfg proxyConfig
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// protectFlags 支持多次指定 -protect，格式为 route 或 route=timeout
+type protectFlags []string
+
+func (p *protectFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *protectFlags) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+func parseProtect(value string, defaultTimeout time.Duration) (fastgocaptcha.FastGoCaptchaRouteConfig, error) {
+	route, rawTimeout, ok := strings.Cut(value, "=")
+	timeout := defaultTimeout
+	if ok {
+		var err error
+		timeout, err = time.ParseDuration(rawTimeout)
+		if err != nil {
+			return fastgocaptcha.FastGoCaptchaRouteConfig{}, fmt.Errorf("invalid timeout in -protect %q: %v", value, err)
+		}
+	}
+	return fastgocaptcha.FastGoCaptchaRouteConfig{
+		Route:   route,
+		Timeout: fastgocaptcha.Duration(timeout),
+	}, nil
+}
+
+func main() {
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 在返回前执行所有 defer，保证配置监听和会话清理被停止
+func run() error {
+	var (
+		configFile      = flag.String("config", "", "JSON config file, protect rules are reloaded when it changes")
+		listen          = flag.String("listen", "", "listen address (default :8080)")
+		upstream        = flag.String("upstream", "", "upstream URL, e.g. http://127.0.0.1:3000")
+		tlsCert         = flag.String("tls-cert", "", "TLS certificate file")
+		tlsKey          = flag.String("tls-key", "", "TLS key file")
+		preserveHost    = flag.Bool("preserve-host", false, "pass the original Host header to the upstream")
+		defaultTimeout  = flag.Duration("timeout", 30*time.Minute, "timeout for -protect routes without an explicit timeout, 0 means every time")
+		defaultScope    = flag.String("scope", "", "default verification scope: path, matcher or site")
+		shutdownTimeout = flag.Duration("shutdown-timeout", 0, "graceful shutdown timeout (default 10s)")
+		captchaImages   = flag.String("captcha-images", "", "directory with backgrounds/ and tiles/ used instead of the default captcha images")
+		verbose         = flag.Bool("v", false, "verbose logging")
+		protects        protectFlags
+	)
+	flag.Var(&protects, "protect", "protected route glob, route or route=timeout, can be repeated (default /*)")
+	flag.Parse()
+
+	cfg := &proxyConfig{}
+	if *configFile != "" {
+		loaded, err := loadProxyConfig(*configFile)
+		if err != nil {
+			return fmt.Errorf("load config failed: %v", err)
+		}
+		cfg = loaded
+	}
+
+	// 命令行参数优先于配置文件
+	if *listen != "" {
+		cfg.Listen = *listen
+	}
+	if *upstream != "" {
+		cfg.Upstream = *upstream
+	}
+	if *tlsCert != "" {
+		cfg.TLSCert = *tlsCert
+	}
+	if *tlsKey != "" {
+		cfg.TLSKey = *tlsKey
+	}
+	if *preserveHost {
+		cfg.PreserveHost = true
+	}
+	if *shutdownTimeout > 0 {
+		cfg.ShutdownTimeout = fastgocaptcha.Duration(*shutdownTimeout)
+	}
+	if *defaultScope != "" {
+		cfg.DefaultScope = *defaultScope
+	}
+	if *captchaImages != "" {
+		cfg.CaptchaImages = *captchaImages
+	}
+	for _, value := range protects {
+		route, err := parseProtect(value, *defaultTimeout)
+		if err != nil {
+			return err
+		}
+		cfg.Routes = append(cfg.Routes, route)
+	}
+
+	if cfg.Listen == "" {
+		cfg.Listen = ":8080"
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = fastgocaptcha.Duration(10 * time.Second)
+	}
+	// 没有配置任何保护规则时保护整个站点
+	withDefaultRoutes := func(rules *fastgocaptcha.FastGoCaptchaConfig) *fastgocaptcha.FastGoCaptchaConfig {
+		if len(rules.Routes) == 0 {
+			rules.Routes = []fastgocaptcha.FastGoCaptchaRouteConfig{{Route: "/*", Timeout: fastgocaptcha.Duration(*defaultTimeout)}}
+		}
+		return rules
+	}
+	if cfg.Upstream == "" {
+		return errors.New("upstream is required, use -upstream or \"upstream\" in the config file")
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("tls cert and key must be provided together")
+	}
+	target, err := url.Parse(cfg.Upstream)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("invalid upstream url: %s", cfg.Upstream)
+	}
+	scope, err := fastgocaptcha.ParseProtectScope(cfg.DefaultScope)
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	options := []fastgocaptcha.FastGoCaptchaOption{
+		fastgocaptcha.WithDefaultProtectScope(scope),
+		fastgocaptcha.WithLogger(logger),
+	}
+	if cfg.CaptchaImages != "" {
+		options = append(options, fastgocaptcha.WithCaptchaImagesDir(cfg.CaptchaImages))
+	}
+	captcha, err := fastgocaptcha.NewFastGoCaptcha(options...)
+	if err != nil {
+		return fmt.Errorf("create fast go captcha failed: %v", err)
+	}
+	defer captcha.Close()
+
+	if err := captcha.ApplyConfig(withDefaultRoutes(&cfg.FastGoCaptchaConfig)); err != nil {
+		return fmt.Errorf("apply protect rules failed: %v", err)
+	}
+	if *configFile != "" && len(protects) == 0 {
+		stop, err := captcha.WatchConfigFileWithLoader(*configFile, 0, func(path string) (*fastgocaptcha.FastGoCaptchaConfig, error) {
+			reloaded, err := loadProxyConfig(path)
+			if err != nil {
+				return nil, err
+			}
+			return withDefaultRoutes(&reloaded.FastGoCaptchaConfig), nil
+		})
+		if err != nil {
+			return fmt.Errorf("watch config failed: %v", err)
+		}
+		defer stop()
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+			if cfg.PreserveHost {
+				r.Out.Host = r.In.Host
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("proxy %s %s failed: %s", r.Method, r.URL.Path, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           captcha.Middleware(proxy),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("fastgocaptcha-proxy listening at %s, upstream: %s", cfg.Listen, target)
+		if cfg.TLSCert != "" {
+			serveErr <- server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("serve failed: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("shutting down, waiting up to %v for active requests", time.Duration(cfg.ShutdownTimeout))
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+		defer cancelShutdown()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("graceful shutdown failed: %s", err)
+		}
+	}
+	return nil
+}
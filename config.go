@@ -0,0 +1,386 @@
+package fastgocaptcha
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/glob"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigPollInterval = 2 * time.Second
+
+// Duration 支持 "10m" 这样的字符串，也支持以秒为单位的数字
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var raw any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(time.Duration(v * float64(time.Second)))
+	case string:
+		if strings.TrimSpace(v) == "" {
+			*d = 0
+			return nil
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %v", v, err)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(b))
+	}
+	if *d < 0 {
+		return fmt.Errorf("duration must not be negative: %s", string(b))
+	}
+	return nil
+}
+
+type FastGoCaptchaRouteConfig struct {
+	Route string `json:"route"`
+	// Timeout 为 0 时每次访问都需要验证
+	Timeout Duration `json:"timeout"`
+	// Scope 可选 path/matcher/group/site，设置 Group 时默认为 group
+	Scope string `json:"scope,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+type FastGoCaptchaConfig struct {
+	Routes []FastGoCaptchaRouteConfig `json:"routes"`
+	// AllowPaths 中的路径即使命中保护规则也直接放行
+	AllowPaths []string `json:"allow_paths"`
+	// AllowIPs 支持单个 IP 或 CIDR
+	AllowIPs []string `json:"allow_ips"`
+}
+
+// compiledConfig 是校验通过、可以直接替换进 FastGoCaptcha 的规则集
+type compiledConfig struct {
+	matchers   map[string]*FastGoCaptchaMatcher
+	allowPaths []glob.Glob
+	allowIPs   []*net.IPNet
+}
+
+func ParseConfig(raw []byte) (*FastGoCaptchaConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	var cfg FastGoCaptchaConfig
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return &cfg, nil
+}
+
+// ParseYAMLConfig 解析 YAML 格式的配置，字段名与 JSON 相同
+func ParseYAMLConfig(raw []byte) (*FastGoCaptchaConfig, error) {
+	var doc any
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	// 转换为 JSON 后复用同一套校验，未知字段和时长格式的处理与 JSON 配置一致
+	converted, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return ParseConfig(converted)
+}
+
+// LoadConfigFile 按扩展名读取 JSON（.json 或无扩展名）或 YAML（.yaml/.yml）配置文件
+func LoadConfigFile(path string) (*FastGoCaptchaConfig, error) {
+	var parse func([]byte) (*FastGoCaptchaConfig, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", "":
+		parse = ParseConfig
+	case ".yaml", ".yml":
+		parse = ParseYAMLConfig
+	default:
+		return nil, fmt.Errorf("unsupported config file format: %s, only json and yaml are supported", path)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(raw)
+}
+
+func parseAllowIP(raw string) (*net.IPNet, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "/") {
+		_, ipNet, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow ip %s: %v", raw, err)
+		}
+		return ipNet, nil
+	}
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid allow ip %s", raw)
+	}
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	} else {
+		ip = ip.To4()
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Validate 检查配置是否合法，所有错误都会被返回，而不是像 AddProtectMatcherWithTimeout 那样跳过
+func (c *FastGoCaptchaConfig) Validate() error {
+	_, err := c.compile()
+	return err
+}
+
+func (c *FastGoCaptchaConfig) compile() (*compiledConfig, error) {
+	compiled := &compiledConfig{
+		matchers: make(map[string]*FastGoCaptchaMatcher),
+	}
+	var errs []string
+	for i, route := range c.Routes {
+		if strings.TrimSpace(route.Route) == "" {
+			errs = append(errs, fmt.Sprintf("routes[%d]: route is empty", i))
+			continue
+		}
+		scope, err := ParseProtectScope(route.Scope)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("routes[%d]: %v", i, err))
+			continue
+		}
+		var opts []ProtectMatcherOption
+		if route.Group != "" && (scope == "" || scope == ScopeGroup) {
+			opts = append(opts, WithMatcherGroup(route.Group))
+		} else if scope != "" {
+			opts = append(opts, WithMatcherScope(scope))
+		}
+		for _, expanded := range expandProtectRoute(route.Route) {
+			// 自动补充的 route/ 与保留路由冲突时跳过，例如 /* 展开的 /*/ 会匹配 /fastgocaptcha/
+			if expanded != route.Route {
+				if g, err := glob.Compile(expanded, rune('/')); err == nil && !testRoute(g) {
+					continue
+				}
+			}
+			matcher, err := compileProtectMatcher(route.Route, expanded, time.Duration(route.Timeout), opts...)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("routes[%d]: %v", i, err))
+				continue
+			}
+			compiled.matchers[expanded] = matcher
+		}
+	}
+	for i, path := range c.AllowPaths {
+		g, err := glob.Compile(path, rune('/'))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("allow_paths[%d]: failed to compile glob %s: %v", i, path, err))
+			continue
+		}
+		compiled.allowPaths = append(compiled.allowPaths, g)
+	}
+	for i, raw := range c.AllowIPs {
+		ipNet, err := parseAllowIP(raw)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("allow_ips[%d]: %v", i, err))
+			continue
+		}
+		compiled.allowIPs = append(compiled.allowIPs, ipNet)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return compiled, nil
+}
+
+// ApplyConfig 校验并原子替换上一次配置中的保护规则和白名单，
+// 通过 AddProtectMatcher 或管理接口添加的规则会保留，与配置中的规则相同时以配置为准
+func (f *FastGoCaptcha) ApplyConfig(cfg *FastGoCaptchaConfig) error {
+	if cfg == nil {
+		return fmt.Errorf("config is nil")
+	}
+	compiled, err := cfg.compile()
+	if err != nil {
+		return err
+	}
+	for _, matcher := range compiled.matchers {
+		matcher.fromConfig = true
+	}
+
+	f.matcherMutex.Lock()
+	old := make(map[string]*FastGoCaptchaMatcher)
+	matchers := make(map[string]*FastGoCaptchaMatcher, len(f.matchers)+len(compiled.matchers))
+	var overridden []string
+	for route, matcher := range f.matchers {
+		if matcher.fromConfig {
+			old[route] = matcher
+			continue
+		}
+		if _, ok := compiled.matchers[route]; ok {
+			overridden = append(overridden, route)
+			continue
+		}
+		matchers[route] = matcher
+	}
+	for route, matcher := range compiled.matchers {
+		matchers[route] = matcher
+	}
+	f.matchers = matchers
+	f.allowPaths = compiled.allowPaths
+	f.allowIPs = compiled.allowIPs
+	f.matcherMutex.Unlock()
+
+	sort.Strings(overridden)
+	for _, route := range overridden {
+		f.logWarning("config: protect matcher replaces a matcher added in code", "matcher", route)
+	}
+	f.logMatcherDiff(old, compiled.matchers)
+	return nil
+}
+
+func (f *FastGoCaptcha) logMatcherDiff(old, new map[string]*FastGoCaptchaMatcher) {
+	var routes []string
+	for route := range old {
+		routes = append(routes, route)
+	}
+	for route := range new {
+		if _, ok := old[route]; !ok {
+			routes = append(routes, route)
+		}
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		before, hadBefore := old[route]
+		after, hasAfter := new[route]
+		switch {
+		case !hadBefore:
+			f.logInfo("config: add protect matcher", "matcher", route, "timeout", after.timeout)
+		case !hasAfter:
+			f.logInfo("config: remove protect matcher", "matcher", route)
+		case before.timeout != after.timeout:
+			f.logInfo("config: update protect matcher timeout", "matcher", route, "from", before.timeout, "to", after.timeout)
+		case before.scope != after.scope || before.group != after.group:
+			f.logInfo("config: update protect matcher scope", "matcher", route, "from", before.scope, "from_group", before.group, "to", after.scope, "to_group", after.group)
+		}
+	}
+}
+
+func (f *FastGoCaptcha) ApplyConfigFile(path string) error {
+	cfg, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return f.ApplyConfig(cfg)
+}
+
+// WatchConfigFile 加载配置文件，并在文件变化时重新加载；
+// 新配置不合法时保留旧规则并通过 errorf 输出错误
+func (f *FastGoCaptcha) WatchConfigFile(path string, interval time.Duration) (stop func(), err error) {
+	return f.WatchConfigFileWithLoader(path, interval, LoadConfigFile)
+}
+
+// WatchConfigFileWithLoader 与 WatchConfigFile 相同，但使用自定义的 load 解析文件，
+// 适用于保护规则嵌在更大的配置文件中的情况
+func (f *FastGoCaptcha) WatchConfigFileWithLoader(path string, interval time.Duration, load func(path string) (*FastGoCaptchaConfig, error)) (stop func(), err error) {
+	if interval <= 0 {
+		interval = defaultConfigPollInterval
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	apply := func() error {
+		cfg, err := load(path)
+		if err != nil {
+			return err
+		}
+		return f.ApplyConfig(cfg)
+	}
+	if err := apply(); err != nil {
+		return nil, err
+	}
+
+	lastModTime, lastSize := info.ModTime(), info.Size()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				f.logError("config: failed to stat config file", "file", path, "error", err)
+				continue
+			}
+			if info.ModTime().Equal(lastModTime) && info.Size() == lastSize {
+				continue
+			}
+			lastModTime, lastSize = info.ModTime(), info.Size()
+			f.logInfo("config: config file changed, reloading", "file", path)
+			if err := apply(); err != nil {
+				f.logError("config: failed to reload config file, keep previous rules", "file", path, "error", err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}, nil
+}
+
+func WithConfigFile(path string, pollInterval time.Duration) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.configFile = path
+		f.configPollInterval = pollInterval
+	}
+}
+
+func (f *FastGoCaptcha) isAllowlisted(r *http.Request) bool {
+	f.matcherMutex.RLock()
+	defer f.matcherMutex.RUnlock()
+	for _, g := range f.allowPaths {
+		if g.Match(r.URL.Path) {
+			return true
+		}
+	}
+	if len(f.allowIPs) == 0 {
+		return false
+	}
+	ip := net.ParseIP(clientIP(r))
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range f.allowIPs {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
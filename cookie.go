@@ -0,0 +1,149 @@
+package fastgocaptcha
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultSessionCookieName = "fastgocaptcha_session"
+
+// CookieSecureMode 决定会话 cookie 是否带 Secure 属性
+type CookieSecureMode string
+
+const (
+	// CookieSecureAuto 请求经过 TLS 或 X-Forwarded-Proto 为 https 时设置 Secure，适合本地 http 开发
+	CookieSecureAuto CookieSecureMode = ""
+	// CookieSecureAlways 总是设置 Secure
+	CookieSecureAlways CookieSecureMode = "always"
+	// CookieSecureNever 从不设置 Secure，只应在纯 http 环境使用
+	CookieSecureNever CookieSecureMode = "never"
+)
+
+// CookieConfig 配置会话 cookie 的属性，零值字段使用默认值
+type CookieConfig struct {
+	// Name 默认为 fastgocaptcha_session
+	Name string
+	// Domain 为空时只对当前主机有效
+	Domain string
+	// Path 默认为 /
+	Path   string
+	Secure CookieSecureMode
+	// SameSite 为 0 时自动选择：Secure 时为 None（允许跨站嵌入），否则为 Lax
+	SameSite http.SameSite
+	// DisableHttpOnly 允许脚本读取 cookie，默认带 HttpOnly
+	DisableHttpOnly bool
+	// Partitioned 设置 CHIPS 的 Partitioned 属性，要求 Secure
+	Partitioned bool
+}
+
+// WithCookieConfig 设置会话 cookie 的名称、作用域和安全属性
+func WithCookieConfig(config CookieConfig) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.cookie = config
+	}
+}
+
+func (f *FastGoCaptcha) initCookie() error {
+	c := &f.cookie
+	if c.Name == "" {
+		c.Name = defaultSessionCookieName
+	}
+	if !isCookieName(c.Name) {
+		return fmt.Errorf("invalid cookie name: %q", c.Name)
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	switch c.Secure {
+	case CookieSecureAuto, CookieSecureAlways, CookieSecureNever:
+	default:
+		return fmt.Errorf("invalid cookie secure mode: %s", c.Secure)
+	}
+	if c.Secure == CookieSecureNever {
+		if c.SameSite == http.SameSiteNoneMode {
+			return fmt.Errorf("cookie SameSite=None requires Secure")
+		}
+		if c.Partitioned {
+			return fmt.Errorf("partitioned cookie requires Secure")
+		}
+	}
+	return nil
+}
+
+func isCookieName(name string) bool {
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSecureRequest 判断浏览器与服务之间是否是 https，支持反向代理设置的 X-Forwarded-Proto 和 Forwarded
+func isSecureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	// 多级代理时取第一个值，即离浏览器最近的一跳
+	if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); strings.TrimSpace(proto) != "" {
+		return strings.EqualFold(strings.TrimSpace(proto), "https")
+	}
+	forwarded, _, _ := strings.Cut(r.Header.Get("Forwarded"), ",")
+	for _, part := range strings.Split(forwarded, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && strings.EqualFold(key, "proto") {
+			return strings.EqualFold(strings.Trim(value, "\""), "https")
+		}
+	}
+	return false
+}
+
+// sessionCookieValue 从请求中读取会话 ID
+func (f *FastGoCaptcha) sessionCookieValue(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(f.cookie.Name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+func (f *FastGoCaptcha) setSessionCookie(w http.ResponseWriter, r *http.Request, sessionID string) {
+	f.setCookie(w, r, f.cookie.Name, sessionID)
+}
+
+// setCookie 按 CookieConfig 的属性写入 cookie，会话 cookie 和 CSRF cookie 共用
+func (f *FastGoCaptcha) setCookie(w http.ResponseWriter, r *http.Request, name string, value string) {
+	secure := f.cookie.Secure == CookieSecureAlways || f.cookie.Secure == CookieSecureAuto && isSecureRequest(r)
+	sameSite := f.cookie.SameSite
+	if sameSite == 0 {
+		if secure {
+			sameSite = http.SameSiteNoneMode
+		} else {
+			sameSite = http.SameSiteLaxMode
+		}
+	}
+	if sameSite == http.SameSiteNoneMode && !secure {
+		// 浏览器会丢弃没有 Secure 的 SameSite=None cookie
+		sameSite = http.SameSiteLaxMode
+	}
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     f.cookie.Path,
+		Domain:   f.cookie.Domain,
+		HttpOnly: !f.cookie.DisableHttpOnly,
+		MaxAge:   int(f.sessionTimeout.Seconds()),
+		SameSite: sameSite,
+		Secure:   secure,
+	}
+	v := cookie.String()
+	if v == "" {
+		f.logError("invalid cookie", "cookie", name)
+		return
+	}
+	if f.cookie.Partitioned && secure {
+		v += "; Partitioned"
+	}
+	w.Header().Add("Set-Cookie", v)
+}
@@ -0,0 +1,115 @@
+package fastgocaptcha
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCORSAllowedHeaders = []string{"Content-Type", "Accept", "Accept-Language", "X-Requested-With", csrfHeader}
+
+// CORSConfig 配置 /fastgocaptcha/* 接口的跨域访问，前端与验证码服务不在同一个域名时使用
+type CORSConfig struct {
+	// AllowedOrigins 允许的来源，例如 https://app.example.com，"*" 表示任意来源，不能与 AllowCredentials 同时使用
+	AllowedOrigins []string
+	// AllowCredentials 允许跨域请求携带会话 cookie
+	AllowCredentials bool
+	// AllowedHeaders 预检请求允许的请求头，默认 Content-Type、Accept、Accept-Language、X-Requested-With、X-FastGoCaptcha-CSRF
+	AllowedHeaders []string
+	// MaxAge 预检结果的缓存时间，0 表示由浏览器决定
+	MaxAge time.Duration
+}
+
+// WithCORS 为 /fastgocaptcha/* 接口开启 CORS，并响应 OPTIONS 预检请求
+func WithCORS(config CORSConfig) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.cors = &config
+	}
+}
+
+func (f *FastGoCaptcha) initCORS() error {
+	if f.cors == nil {
+		return nil
+	}
+	config := *f.cors
+	origins := make([]string, 0, len(config.AllowedOrigins))
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin == "*" && config.AllowCredentials {
+			return fmt.Errorf("cors: allowed origin \"*\" cannot be used with credentials")
+		}
+		origins = append(origins, strings.ToLower(origin))
+	}
+	if len(origins) == 0 {
+		return fmt.Errorf("cors: at least one allowed origin is required")
+	}
+	if config.MaxAge < 0 {
+		return fmt.Errorf("cors: max age must not be negative")
+	}
+	config.AllowedOrigins = origins
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = defaultCORSAllowedHeaders
+	}
+	f.cors = &config
+	return nil
+}
+
+func (c *CORSConfig) allowOrigin(origin string) (string, bool) {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if allowed == origin {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// handleCORS 设置跨域响应头，预检请求在这里直接响应，返回 true 表示请求已处理
+func (f *FastGoCaptcha) handleCORS(w http.ResponseWriter, r *http.Request) (handled bool) {
+	if f.cors == nil {
+		return false
+	}
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	origin := r.Header.Get("Origin")
+	allowed, ok := f.cors.allowOrigin(origin)
+	if origin == "" || !ok {
+		if preflight {
+			// 不允许的来源不返回 CORS 头，浏览器会拒绝后续请求
+			w.WriteHeader(http.StatusNoContent)
+			return true
+		}
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if f.cors.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		header.Set("Access-Control-Expose-Headers", "X-FastGoCaptcha-Auth")
+		return false
+	}
+
+	header.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	header.Set("Access-Control-Allow-Headers", strings.Join(f.cors.AllowedHeaders, ", "))
+	if f.cors.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(f.cors.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,73 @@
+package fastgocaptcha
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+//go:embed resources/v1.0.9/fastgocaptcha.css
+var fastgocaptchaCSS []byte
+
+//go:embed resources/challenge.js
+var challengeJS []byte
+
+//go:embed resources/challenge.css
+var challengeCSS []byte
+
+// DefaultContentSecurityPolicy 是挑战页面推荐使用的 CSP，{nonce} 会被替换为每个响应生成的 nonce；
+// 验证码图片以 data: URL 的形式返回，所以 img-src 需要允许 data:
+const DefaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'nonce-{nonce}'; " +
+	"style-src 'self' 'nonce-{nonce}'; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'none'; " +
+	"frame-ancestors 'self'"
+
+// resourceIntegrity 保存内置静态资源的 SRI 值，key 为资源文件名
+var resourceIntegrity = map[string]string{
+	"fastgocaptcha.js":     sri(fastgocaptchaJS),
+	"fastgocaptcha.css":    sri(fastgocaptchaCSS),
+	"gocaptcha.global.js":  sri(gocaptchaGlobalJS),
+	"gocaptcha.global.css": sri(gocaptchaGlobalCSS),
+	"challenge.js":         sri(challengeJS),
+	"challenge.css":        sri(challengeCSS),
+}
+
+func sri(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ResourceIntegrity 返回 /fastgocaptcha/resources/ 下内置资源的 SRI 值，例如 ResourceIntegrity("fastgocaptcha.js")
+func ResourceIntegrity(name string) string {
+	return resourceIntegrity[name]
+}
+
+// WithContentSecurityPolicy 在挑战页面上输出 Content-Security-Policy 头，policy 中的 {nonce} 会被替换为本次响应的 nonce，
+// 通常使用 DefaultContentSecurityPolicy 即可
+func WithContentSecurityPolicy(policy string) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.contentSecurityPolicy = policy
+	}
+}
+
+func newNonce() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf[:]), nil
+}
+
+func (f *FastGoCaptcha) setContentSecurityPolicy(w http.ResponseWriter, nonce string) {
+	if f.contentSecurityPolicy == "" {
+		return
+	}
+	w.Header().Set("Content-Security-Policy", strings.ReplaceAll(f.contentSecurityPolicy, "{nonce}", nonce))
+}
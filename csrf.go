@@ -0,0 +1,140 @@
+package fastgocaptcha
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	csrfCookieSuffix = "_csrf"
+	csrfHeader       = "X-FastGoCaptcha-CSRF"
+	csrfField        = "csrf_token"
+)
+
+// WithVerifyOrigins 允许这些来源提交 /fastgocaptcha/verify，可以是主机名（app.example.com）或完整来源（https://app.example.com），
+// 默认只允许与请求 Host 相同的来源以及 WithCORS 中允许的来源
+func WithVerifyOrigins(origins ...string) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		for _, origin := range origins {
+			origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+			if origin != "" {
+				f.verifyOrigins = append(f.verifyOrigins, origin)
+			}
+		}
+	}
+}
+
+// WithVerifyCSRFToken 开启 double-submit CSRF 校验：/fastgocaptcha/captcha 下发 cookie 和 fastgocaptcha_csrf_token，
+// 校验请求需要通过 X-FastGoCaptcha-CSRF 头或 csrf_token 字段带回相同的值
+func WithVerifyCSRFToken() FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.verifyCSRF = true
+	}
+}
+
+func (f *FastGoCaptcha) csrfCookieName() string {
+	return f.cookie.Name + csrfCookieSuffix
+}
+
+// requestOrigin 返回浏览器声明的来源，优先使用 Origin，其次是 Referer
+func requestOrigin(r *http.Request) (*url.URL, bool) {
+	raw := r.Header.Get("Origin")
+	if raw == "" {
+		raw = r.Header.Get("Referer")
+	}
+	if raw == "" {
+		return nil, false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		// Origin: null 或无法解析的来源
+		return &url.URL{}, true
+	}
+	return u, true
+}
+
+// checkVerifyOrigin 拒绝跨站提交的校验请求，没有 Origin/Referer 的非浏览器客户端不受影响
+func (f *FastGoCaptcha) checkVerifyOrigin(r *http.Request) error {
+	origin, ok := requestOrigin(r)
+	if !ok {
+		if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+			return errors.New("cross-site request without origin")
+		}
+		return nil
+	}
+	host := strings.ToLower(origin.Host)
+	if host == "" {
+		return errors.New("opaque origin")
+	}
+	if host == strings.ToLower(r.Host) {
+		return nil
+	}
+	// 经过 nginx 等代理时 Host 可能被改写，跨站表单无法伪造这个头
+	if forwardedHost, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); strings.EqualFold(strings.TrimSpace(forwardedHost), host) {
+		return nil
+	}
+	full := strings.ToLower(origin.Scheme + "://" + origin.Host)
+	for _, allowed := range f.verifyOrigins {
+		if allowed == host || allowed == full {
+			return nil
+		}
+	}
+	if f.cors != nil {
+		if _, ok := f.cors.allowOrigin(full); ok {
+			return nil
+		}
+	}
+	return errors.New("origin is not allowed: " + full)
+}
+
+// issueCSRFToken 复用已有的 CSRF cookie，没有时生成新的，多个标签页可以同时验证
+func (f *FastGoCaptcha) issueCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(f.csrfCookieName()); err == nil && len(cookie.Value) == 43 {
+		return cookie.Value, nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	f.setCookie(w, r, f.csrfCookieName(), token)
+	return token, nil
+}
+
+// checkCSRFToken 比较请求中带回的 token 与 cookie 中的 token
+func (f *FastGoCaptcha) checkCSRFToken(r *http.Request, submitted string) error {
+	if !f.verifyCSRF {
+		return nil
+	}
+	if header := r.Header.Get(csrfHeader); header != "" {
+		submitted = header
+	}
+	cookie, err := r.Cookie(f.csrfCookieName())
+	if err != nil || cookie.Value == "" || submitted == "" {
+		return errors.New("csrf token is missing")
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(submitted)) != 1 {
+		return errors.New("csrf token mismatch")
+	}
+	return nil
+}
+
+// withCSRFToken 在验证码 JSON 中加入 fastgocaptcha_csrf_token
+func withCSRFToken(raw []byte, token string) ([]byte, error) {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+	data["fastgocaptcha_csrf_token"] = encoded
+	return json.Marshal(data)
+}
@@ -0,0 +1,69 @@
+package fastgocaptcha
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed resources/dashboard.html
+var dashboardHTML []byte
+
+//go:embed resources/dashboard.js
+var dashboardJS []byte
+
+//go:embed resources/dashboard.css
+var dashboardCSS []byte
+
+// 面板页面只加载同源的脚本和样式，路径、IP 等数据都以文本方式渲染
+const dashboardContentSecurityPolicy = "default-src 'none'; " +
+	"script-src 'self'; " +
+	"style-src 'self'; " +
+	"connect-src 'self'; " +
+	"base-uri 'none'; " +
+	"form-action 'none'; " +
+	"frame-ancestors 'none'"
+
+// DashboardHandler 提供管理面板，展示最近 StatsWindow 内的通过率、失败原因、被挑战最多的路径、失败最多的 IP 和验证码存储状态，
+// 每 5 秒刷新一次。与 AdminHandler 使用同一套认证，需要先通过 WithAdmin 开启，否则所有请求返回 404。
+// 页面本身不包含数据，可以直接在浏览器中打开，数据来自需要认证的 GET /stats，使用 Token 时页面会要求输入：
+//
+//	mux.Handle("/captcha-dashboard/", http.StripPrefix("/captcha-dashboard", captcha.DashboardHandler()))
+func (f *FastGoCaptcha) DashboardHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Security-Policy", dashboardContentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Write(dashboardHTML)
+	})
+	mux.HandleFunc("GET /dashboard.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(dashboardJS)
+	})
+	mux.HandleFunc("GET /dashboard.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(dashboardCSS)
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		if !f.checkAdmin(w, r) {
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, f.Stats())
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f.admin == nil {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "not found"))
+			return
+		}
+		if _, pattern := mux.Handler(r); pattern == "" {
+			f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "not found"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
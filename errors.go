@@ -0,0 +1,135 @@
+package fastgocaptcha
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrorCode 是所有 /fastgocaptcha/* 接口和保护中间件错误响应中的 code 字段
+type ErrorCode string
+
+const (
+	// ErrCaptchaRequired 受保护的路由需要先完成验证码，见 ChallengeResponse
+	ErrCaptchaRequired ErrorCode = "captcha_required"
+	// ErrMalformed 请求体或参数无法解析
+	ErrMalformed ErrorCode = "malformed"
+	// ErrInvalidID 验证码 ID 格式不正确
+	ErrInvalidID ErrorCode = "invalid_id"
+	// ErrInvalidX 滑动位置不是数字或超出图片范围
+	ErrInvalidX ErrorCode = "invalid_x"
+	// ErrExpired 验证码已过期、已使用或不存在
+	ErrExpired ErrorCode = "expired"
+	// ErrWrongAnswer 滑动位置不正确
+	ErrWrongAnswer ErrorCode = "wrong_answer"
+	// ErrRateLimited 请求过于频繁
+	ErrRateLimited ErrorCode = "rate_limited"
+	// ErrMethodNotAllowed 请求方法不支持
+	ErrMethodNotAllowed ErrorCode = "method_not_allowed"
+	// ErrBodyTooLarge 请求体超过限制
+	ErrBodyTooLarge ErrorCode = "body_too_large"
+	// ErrUnsupportedMediaType Content-Type 不支持
+	ErrUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	// ErrCrossSite 跨站提交
+	ErrCrossSite ErrorCode = "cross_site"
+	// ErrInvalidCSRFToken CSRF token 缺失或不一致
+	ErrInvalidCSRFToken ErrorCode = "invalid_csrf_token"
+	// ErrForeignSession 验证码属于其他会话
+	ErrForeignSession ErrorCode = "foreign_session"
+	// ErrSessionNotFound 没有找到验证码会话
+	ErrSessionNotFound ErrorCode = "session_not_found"
+	// ErrFingerprintMismatch 会话绑定在其他客户端上
+	ErrFingerprintMismatch ErrorCode = "fingerprint_mismatch"
+	// ErrBanned 客户端已被封禁
+	ErrBanned ErrorCode = "banned"
+	// ErrUnauthorized 管理接口认证失败
+	ErrUnauthorized ErrorCode = "unauthorized"
+	// ErrNotFound 接口不存在
+	ErrNotFound ErrorCode = "not_found"
+	// ErrInternal 服务端错误
+	ErrInternal ErrorCode = "internal_error"
+)
+
+// ErrorResponse 是统一的 JSON 错误响应
+type ErrorResponse struct {
+	Success bool      `json:"success"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+type captchaError struct {
+	status  int
+	code    ErrorCode
+	message string
+	// link 是 HTML 错误页面中给出的链接，例如验证码页面地址
+	link string
+}
+
+func (e *captchaError) Error() string {
+	return string(e.code) + ": " + e.message
+}
+
+func newError(status int, code ErrorCode, format string, v ...any) *captchaError {
+	return &captchaError{status: status, code: code, message: fmt.Sprintf(format, v...)}
+}
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Status}} {{.StatusText}}</title>
+</head>
+<body>
+    <h1>{{.Status}} {{.StatusText}}</h1>
+    <p>{{.Message}}</p>
+    {{if .Link}}<p><a href="{{.Link}}">{{.Link}}</a></p>{{end}}
+    <p><code>{{.Code}}</code></p>
+</body>
+</html>
+`))
+
+// prefersHTML 判断请求是否来自浏览器页面导航，只有明确优先接受 text/html 时才返回 HTML 错误页面
+func prefersHTML(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest") {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			return true
+		case "application/json", "text/json", "application/x-json":
+			return false
+		}
+	}
+	return false
+}
+
+// writeError 输出统一的错误响应，浏览器导航请求得到 HTML 页面，其他请求得到 ErrorResponse JSON
+func (f *FastGoCaptcha) writeError(w http.ResponseWriter, r *http.Request, e *captchaError) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r != nil && prefersHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-FastGoCaptcha-Error", string(e.code))
+		w.WriteHeader(e.status)
+		errorPageTemplate.Execute(w, map[string]any{
+			"Locale":     f.requestLocale(r),
+			"Status":     e.status,
+			"StatusText": http.StatusText(e.status),
+			"Message":    e.message,
+			"Code":       e.code,
+			"Link":       e.link,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(ErrorResponse{Success: false, Code: e.code, Message: e.message})
+}
@@ -0,0 +1,180 @@
+package fastgocaptcha
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// EventType 是验证码生命周期事件的类型
+type EventType string
+
+const (
+	// EventChallengeIssued 向客户端发出了验证码挑战
+	EventChallengeIssued EventType = "challenge_issued"
+	// EventVerifySuccess 验证码校验通过
+	EventVerifySuccess EventType = "verify_success"
+	// EventVerifyFailure 验证码校验失败，Reason 为错误码
+	EventVerifyFailure EventType = "verify_failure"
+	// EventBypass 受保护的请求无需验证直接放行，Reason 为 allowlist 或 verified
+	EventBypass EventType = "bypass"
+	// EventSessionCreated 创建了新的验证码会话
+	EventSessionCreated EventType = "session_created"
+	// EventSessionExpired 验证码会话超过 sessionTimeout 被清理
+	EventSessionExpired EventType = "session_expired"
+	// EventRateLimited 请求被限流，见 RejectRateLimited
+	EventRateLimited EventType = "rate_limited"
+	// EventBanned 被封禁的客户端请求被拒绝，见 Ban
+	EventBanned EventType = "banned"
+)
+
+// ChallengeType 表示验证码是通过哪种方式发给客户端的
+type ChallengeType string
+
+const (
+	// ChallengeTypePage 浏览器被跳转到挑战页面
+	ChallengeTypePage ChallengeType = "page"
+	// ChallengeTypeJSON API/XHR 客户端收到 JSON 挑战
+	ChallengeTypeJSON ChallengeType = "json"
+	// ChallengeTypeForwardAuth 通过 /fastgocaptcha/auth/challenge 发起的挑战
+	ChallengeTypeForwardAuth ChallengeType = "forward_auth"
+	// ChallengeTypeWidget /fastgocaptcha/captcha 重新生成的验证码，例如刷新或独立使用的组件
+	ChallengeTypeWidget ChallengeType = "widget"
+)
+
+const (
+	bypassAllowlist = "allowlist"
+	bypassVerified  = "verified"
+)
+
+// Event 是传给 EventListener 的事件上下文，会话过期事件没有请求信息
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	Method    string `json:"method,omitempty"`
+	Host      string `json:"host,omitempty"`
+	URI       string `json:"uri,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+
+	SessionID string `json:"session_id,omitempty"`
+	CaptchaID string `json:"captcha_id,omitempty"`
+	// Path 是受保护的路径，/fastgocaptcha/* 接口上取 fastgocaptcha_path
+	Path string `json:"path,omitempty"`
+	// Matcher 是命中的保护规则
+	Matcher string       `json:"matcher,omitempty"`
+	Scope   ProtectScope `json:"scope,omitempty"`
+	// Challenge 只在 EventChallengeIssued 中设置
+	Challenge ChallengeType `json:"challenge,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	// Latency 在校验事件中是验证码签发到提交的耗时，会话过期事件中是会话存活时间
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+// EventListener 接收验证码生命周期事件，在请求处理过程中同步调用，耗时操作应当自行异步处理
+type EventListener interface {
+	OnEvent(e *Event)
+}
+
+// EventListenerFunc 把普通函数适配为 EventListener
+type EventListenerFunc func(e *Event)
+
+func (fn EventListenerFunc) OnEvent(e *Event) {
+	fn(e)
+}
+
+// WithEventListener 添加事件监听器，可以多次使用
+func WithEventListener(listener EventListener) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		if listener != nil {
+			f.eventListeners = append(f.eventListeners, listener)
+		}
+	}
+}
+
+// emitEvent 补全请求相关的字段，更新指标和统计、写入日志和审计记录并通知所有监听器，r 可以为 nil
+func (f *FastGoCaptcha) emitEvent(r *http.Request, e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if r != nil {
+		e.Method = r.Method
+		e.Host = r.Host
+		e.URI = r.URL.RequestURI()
+		e.ClientIP = clientIP(r)
+		e.UserAgent = r.UserAgent()
+		e.Referer = r.Referer()
+		if e.SessionID == "" {
+			e.SessionID, _ = f.sessionCookieValue(r)
+		}
+		if e.Path == "" {
+			e.Path, _ = f.GetCaptchaRequiredPath(r)
+		}
+	}
+	if e.Path != "" && e.Matcher == "" {
+		if protected, matcher := f.CheckProtectMatcher(e.Path); protected {
+			e.Matcher = matcher.rawRoute
+			e.Scope = f.matcherScope(matcher)
+		}
+	}
+	f.metrics.record(e)
+	f.stats.record(e)
+	f.auditEvent(e)
+	f.logInfo("captcha "+string(e.Type), e.logAttrs(f.hashSessionID(e.SessionID))...)
+	for _, listener := range f.eventListeners {
+		f.notifyListener(listener, e)
+	}
+}
+
+// logAttrs 返回事件的日志字段，省略空值，会话 ID 只记录哈希
+func (e *Event) logAttrs(sessionHash string) []any {
+	attrs := []any{"outcome", string(e.Type)}
+	for _, kv := range [][2]string{
+		{"session_id", sessionHash},
+		{"captcha_id", e.CaptchaID},
+		{"path", e.Path},
+		{"matcher", e.Matcher},
+		{"client_ip", e.ClientIP},
+		{"reason", e.Reason},
+	} {
+		if kv[1] != "" {
+			attrs = append(attrs, kv[0], kv[1])
+		}
+	}
+	if e.Latency > 0 {
+		attrs = append(attrs, "latency", e.Latency)
+	}
+	return attrs
+}
+
+func (f *FastGoCaptcha) notifyListener(listener EventListener, e *Event) {
+	defer func() {
+		if err := recover(); err != nil {
+			f.logError("event listener panic", "event", e.Type, "error", err)
+		}
+	}()
+	listener.OnEvent(e)
+}
+
+// verifyFailed 记录校验失败事件并返回错误响应
+func (f *FastGoCaptcha) verifyFailed(w http.ResponseWriter, r *http.Request, data *SlideBlockWrapper, captchaID string, e *captchaError) {
+	f.emitEvent(r, &Event{
+		Type:      EventVerifyFailure,
+		CaptchaID: captchaID,
+		Reason:    string(e.code),
+		Latency:   data.age(),
+	})
+	f.writeError(w, r, e)
+}
+
+// RejectRateLimited 返回 429 rate_limited 错误并触发 EventRateLimited，
+// 供放在 Middleware 前面的限流器使用，使限流响应和事件与其他错误保持一致
+func (f *FastGoCaptcha) RejectRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	f.emitEvent(r, &Event{Type: EventRateLimited})
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10))
+	}
+	f.writeError(w, r, newError(http.StatusTooManyRequests, ErrRateLimited, "too many requests"))
+}
@@ -4,9 +4,11 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net"
 	"net/http"
-	"net/url"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,8 +16,6 @@ import (
 	"github.com/gobwas/glob"
 
 	"github.com/google/uuid"
-	"github.com/wenlng/go-captcha-assets/resources/images"
-	"github.com/wenlng/go-captcha-assets/resources/tiles"
 	"github.com/wenlng/go-captcha/v2/slide"
 )
 
@@ -34,23 +34,93 @@ var testPage []byte
 type SlideBlockWrapper struct {
 	data    *slide.Block
 	rawData []byte
+	// sessionID 是签发该验证码的会话，为空表示未绑定会话（独立使用的验证码）
+	sessionID string
+	// imageWidth 是背景图宽度，用于检查 x 的范围
+	imageWidth int
+	createdAt  time.Time
+}
+
+// age 返回验证码生成至今的时间，用于事件中的 Latency
+func (s *SlideBlockWrapper) age() time.Duration {
+	if s == nil || s.createdAt.IsZero() {
+		return 0
+	}
+	return time.Since(s.createdAt)
 }
 
 type FastGoCaptchaMatcher struct {
-	glob    glob.Glob
-	timeout time.Duration
+	route    string
+	rawRoute string
+	glob     glob.Glob
+	timeout  time.Duration
+	scope    ProtectScope
+	group    string
+	// fromConfig 表示规则来自配置文件，重新加载配置时只替换这部分规则
+	fromConfig bool
 }
 
 type FastGoCaptcha struct {
 	requestURIPrefix string
 	slideCaptcha     slide.Captcha
+	captchaImages    fs.FS
+	captchaImagesDir string
+	captchaImage     CaptchaImageConfig
 
 	matcherMutex sync.RWMutex
 	matchers     map[string]*FastGoCaptchaMatcher
-
-	sessionTimeout time.Duration
-	sessionManager *sync.Map
-
+	defaultScope ProtectScope
+	allowPaths   []glob.Glob
+	allowIPs     []*net.IPNet
+
+	banMutex sync.RWMutex
+	bans     map[string]*Ban
+
+	challengeStatusCode   int
+	forwardAuthStatusCode int
+	trustedProxies        []string
+	trustedProxyNets      []*net.IPNet
+
+	returnToSecret []byte
+	returnToHosts  []string
+
+	cors          *CORSConfig
+	verifyOrigins []string
+	verifyCSRF    bool
+	cookie        CookieConfig
+	fingerprint   *FingerprintConfig
+	audit         *AuditConfig
+	// sessionHashKey 用于在日志和审计记录中隐藏会话 ID
+	sessionHashKey []byte
+	admin          *AdminConfig
+
+	verifyMaxBodySize int64
+
+	challengeTemplate *template.Template
+	challengeTheme    ChallengeTheme
+	challengeAssets   fs.FS
+	catalogs          map[string]MessageCatalog
+	defaultLocale     string
+
+	contentSecurityPolicy string
+
+	replayMaxBodySize int64
+	replayTimeout     time.Duration
+
+	configFile         string
+	configPollInterval time.Duration
+	stopConfigWatch    func()
+
+	metrics      *captchaMetrics
+	stats        *captchaStats
+	captchaStore *sync.Map
+
+	sessionTimeout   time.Duration
+	sessionManager   *sync.Map
+	stopSessionSweep func()
+	eventListeners   []EventListener
+
+	logger   *slog.Logger
 	infof    func(format string, v ...any)
 	warningf func(format string, v ...any)
 	errorf   func(format string, v ...any)
@@ -60,17 +130,28 @@ type FastGoCaptcha struct {
 	deleteGoCaptchaData func(id string)
 }
 
+// reservedRoutes 是 /fastgocaptcha/* 接口使用的路径，不能被保护规则匹配
+var reservedRoutes = []string{
+	"/fastgocaptcha/",
+	"/fastgocaptcha/captcha",
+	"/fastgocaptcha/verify",
+	"/fastgocaptcha/resources/fastgocaptcha.js",
+	"/fastgocaptcha/resources/gocaptcha.global.css",
+	"/fastgocaptcha/resources/gocaptcha.global.js",
+	"/fastgocaptcha/session/captcha",
+	"/fastgocaptcha/resources/fastgocaptcha.i18n.js",
+	"/fastgocaptcha/resources/fastgocaptcha.css",
+	"/fastgocaptcha/resources/challenge.js",
+	"/fastgocaptcha/resources/challenge.css",
+	"/fastgocaptcha/assets/",
+	"/fastgocaptcha/auth",
+	"/fastgocaptcha/auth/challenge",
+	"/fastgocaptcha/auth/return",
+}
+
 func testRoute(glob glob.Glob) (ok bool) {
 	ok = true
-	for _, route := range []string{
-		"/fastgocaptcha/",
-		"/fastgocaptcha/captcha",
-		"/fastgocaptcha/verify",
-		"/fastgocaptcha/resources/fastgocaptcha.js",
-		"/fastgocaptcha/resources/gocaptcha.global.css",
-		"/fastgocaptcha/resources/gocaptcha.global.js",
-		"/fastgocaptcha/session/captcha",
-	} {
+	for _, route := range reservedRoutes {
 		if glob.Match(route) {
 			return false
 		}
@@ -78,37 +159,65 @@ func testRoute(glob glob.Glob) (ok bool) {
 	return true
 }
 
-func (f *FastGoCaptcha) addProtectMatcher(rawRoute string, timeout time.Duration) error {
-	f.matcherMutex.Lock()
-	defer f.matcherMutex.Unlock()
+func isReservedRoute(path string) bool {
+	if strings.HasPrefix(path, "/fastgocaptcha/assets/") {
+		return true
+	}
+	for _, route := range reservedRoutes {
+		if path == route {
+			return true
+		}
+	}
+	return false
+}
+
+func compileProtectMatcher(rawRoute, route string, timeout time.Duration, opts ...ProtectMatcherOption) (*FastGoCaptchaMatcher, error) {
+	g, err := glob.Compile(route, rune('/'))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile glob %s: %v", route, err)
+	}
+	if !testRoute(g) {
+		return nil, fmt.Errorf("route %s is not allowed", route)
+	}
+	matcher := &FastGoCaptchaMatcher{
+		route:    route,
+		rawRoute: rawRoute,
+		glob:     g,
+		timeout:  timeout,
+	}
+	for _, opt := range opts {
+		opt(matcher)
+	}
+	if err := matcher.validateScope(); err != nil {
+		return nil, fmt.Errorf("route %s: %v", route, err)
+	}
+	return matcher, nil
+}
 
+func expandProtectRoute(rawRoute string) []string {
 	var routes []string = make([]string, 0, 2)
 	routes = append(routes, rawRoute)
 	if !strings.HasSuffix(rawRoute, "/") {
 		routes = append(routes, rawRoute+"/")
 	}
+	return routes
+}
+
+func (f *FastGoCaptcha) addProtectMatcher(rawRoute string, timeout time.Duration, opts ...ProtectMatcherOption) error {
+	f.matcherMutex.Lock()
+	defer f.matcherMutex.Unlock()
 
 	if f.matchers == nil {
 		f.matchers = make(map[string]*FastGoCaptchaMatcher)
 	}
 
-	for _, route := range routes {
-
-		glob, err := glob.Compile(route, rune('/'))
+	for _, route := range expandProtectRoute(rawRoute) {
+		matcher, err := compileProtectMatcher(rawRoute, route, timeout, opts...)
 		if err != nil {
-			f.logErrorf("failed to compile glob: %v", err)
+			f.logError("invalid protect matcher", "error", err)
 			continue
 		}
-
-		if !testRoute(glob) {
-			f.logErrorf("route %s is not allowed", route)
-			continue
-		}
-
-		f.matchers[route] = &FastGoCaptchaMatcher{
-			glob:    glob,
-			timeout: timeout,
-		}
+		f.matchers[route] = matcher
 	}
 	return nil
 }
@@ -121,15 +230,42 @@ func (f *FastGoCaptcha) AddProtectMatcherEverytime(route string) error {
 	return f.addProtectMatcher(route, 0)
 }
 
+// AddProtectMatcher 添加保护规则，可以通过 WithMatcherScope/WithMatcherGroup 指定验证范围
+func (f *FastGoCaptcha) AddProtectMatcher(route string, timeout time.Duration, opts ...ProtectMatcherOption) error {
+	return f.addProtectMatcher(route, timeout, opts...)
+}
+
+// CheckProtectMatcher 返回命中路径的保护规则，多条规则同时命中时选择最具体的一条：
+// 通配符最少的优先，其次是原始规则最长的，最后按字典序，保证同一路径总是得到相同的验证范围
 func (f *FastGoCaptcha) CheckProtectMatcher(path string) (protected bool, matcher *FastGoCaptchaMatcher) {
 	f.matcherMutex.RLock()
 	defer f.matcherMutex.RUnlock()
-	for _, matcher := range f.matchers {
-		if matcher.glob.Match(path) {
-			return true, matcher
+	for _, m := range f.matchers {
+		if !m.glob.Match(path) {
+			continue
+		}
+		if matcher == nil || moreSpecificMatcher(m, matcher) {
+			matcher = m
 		}
 	}
-	return false, nil
+	return matcher != nil, matcher
+}
+
+func moreSpecificMatcher(a, b *FastGoCaptchaMatcher) bool {
+	if wa, wb := routeWildcards(a.rawRoute), routeWildcards(b.rawRoute); wa != wb {
+		return wa < wb
+	}
+	if len(a.rawRoute) != len(b.rawRoute) {
+		return len(a.rawRoute) > len(b.rawRoute)
+	}
+	if a.rawRoute != b.rawRoute {
+		return a.rawRoute < b.rawRoute
+	}
+	return a.route < b.route
+}
+
+func routeWildcards(route string) int {
+	return strings.Count(route, "*") + strings.Count(route, "?")
 }
 
 func (f *FastGoCaptcha) RemoveProtectMatcher(route string) {
@@ -165,10 +301,23 @@ func WithDeleteGoCaptchaData(delete func(id string)) FastGoCaptchaOption {
 }
 
 func NewFastGoCaptcha(options ...FastGoCaptchaOption) (*FastGoCaptcha, error) {
-	captcha := &FastGoCaptcha{}
+	captcha := &FastGoCaptcha{metrics: newCaptchaMetrics(), stats: newCaptchaStats()}
 	for _, option := range options {
 		option(captcha)
 	}
+	// 构造失败时关闭已经交给 WithAudit 的审计输出，避免文件句柄泄漏
+	ok := false
+	defer func() {
+		if !ok {
+			captcha.closeAudit()
+		}
+	}()
+
+	switch captcha.defaultScope {
+	case "", ScopePath, ScopeMatcher, ScopeSite:
+	default:
+		return nil, fmt.Errorf("invalid default protect scope: %s", captcha.defaultScope)
+	}
 
 	// 检查存储相关函数是否都具备
 	if (captcha.storeGoCaptchaData != nil || captcha.loadGoCaptchaData != nil || captcha.deleteGoCaptchaData != nil) &&
@@ -178,7 +327,8 @@ func NewFastGoCaptcha(options ...FastGoCaptchaOption) (*FastGoCaptcha, error) {
 
 	// 如果都不具备，使用 sync.Map 作为默认存储
 	if captcha.storeGoCaptchaData == nil && captcha.loadGoCaptchaData == nil && captcha.deleteGoCaptchaData == nil {
-		var captchaStore sync.Map
+		captchaStore := new(sync.Map)
+		captcha.captchaStore = captchaStore
 
 		captcha.storeGoCaptchaData = func(id string, data *SlideBlockWrapper) {
 			captchaStore.Store(id, data)
@@ -198,32 +348,18 @@ func NewFastGoCaptcha(options ...FastGoCaptchaOption) (*FastGoCaptcha, error) {
 		}
 	}
 
-	builder := slide.NewBuilder(
-		slide.WithEnableGraphVerticalRandom(true),
-	)
-	imgs, err := images.GetImages()
-	if err != nil {
+	if err := captcha.initCaptchaImage(); err != nil {
 		return nil, err
 	}
-
-	graphs, err := tiles.GetTiles()
+	builder := slide.NewBuilder(captcha.captchaImage.builderOptions()...)
+	backgrounds, graphs, err := captcha.loadCaptchaResources()
 	if err != nil {
 		return nil, err
 	}
 
-	var newGraphs = make([]*slide.GraphImage, 0, len(graphs))
-	for i := 0; i < len(graphs); i++ {
-		graph := graphs[i]
-		newGraphs = append(newGraphs, &slide.GraphImage{
-			OverlayImage: graph.OverlayImage,
-			MaskImage:    graph.MaskImage,
-			ShadowImage:  graph.ShadowImage,
-		})
-	}
-
 	builder.SetResources(
-		slide.WithGraphImages(newGraphs),
-		slide.WithBackgrounds(imgs),
+		slide.WithGraphImages(graphs),
+		slide.WithBackgrounds(backgrounds),
 	)
 
 	captcha.slideCaptcha = builder.Make()
@@ -231,9 +367,78 @@ func NewFastGoCaptcha(options ...FastGoCaptchaOption) (*FastGoCaptcha, error) {
 	if captcha.sessionTimeout <= 0 {
 		captcha.sessionTimeout = 30 * time.Minute
 	}
+	switch captcha.challengeStatusCode {
+	case 0:
+		captcha.challengeStatusCode = http.StatusPreconditionRequired
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusPreconditionRequired:
+	default:
+		return nil, fmt.Errorf("challenge status code must be 401, 403 or 428, got %d", captcha.challengeStatusCode)
+	}
+	switch captcha.forwardAuthStatusCode {
+	case 0:
+		captcha.forwardAuthStatusCode = http.StatusUnauthorized
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect:
+	default:
+		return nil, fmt.Errorf("forward auth status code must be 401, 403, 302, 303 or 307, got %d", captcha.forwardAuthStatusCode)
+	}
+	if err := captcha.initReturnTo(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initCORS(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initCookie(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initTrustedProxies(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initFingerprint(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initAudit(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initSessionHashKey(); err != nil {
+		return nil, err
+	}
+	if err := captcha.initAdmin(); err != nil {
+		return nil, err
+	}
+	captcha.initChallengePage()
+	if captcha.replayMaxBodySize == 0 {
+		captcha.replayMaxBodySize = defaultReplayMaxBodySize
+	}
+	if captcha.verifyMaxBodySize <= 0 {
+		captcha.verifyMaxBodySize = defaultVerifyMaxBodySize
+	}
+	if captcha.replayTimeout <= 0 {
+		captcha.replayTimeout = defaultReplayTimeout
+	}
+
+	if captcha.configFile != "" {
+		stop, err := captcha.WatchConfigFile(captcha.configFile, captcha.configPollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config file %s: %v", captcha.configFile, err)
+		}
+		captcha.stopConfigWatch = stop
+	}
+	captcha.stopSessionSweep = captcha.startSessionSweeper()
+	ok = true
 	return captcha, nil
 }
 
+// Close 停止后台任务（如配置文件监听、过期会话清理），并关闭实现了 io.Closer 的审计输出
+func (f *FastGoCaptcha) Close() error {
+	if f.stopConfigWatch != nil {
+		f.stopConfigWatch()
+	}
+	if f.stopSessionSweep != nil {
+		f.stopSessionSweep()
+	}
+	return f.closeAudit()
+}
+
 func (f *FastGoCaptcha) GetRequestURI() string {
 	return f.requestURIPrefix
 }
@@ -245,90 +450,136 @@ func (f *FastGoCaptcha) GetTestPageHTTPHandler() http.Handler {
 	})
 }
 
+// Middleware 同时提供 /fastgocaptcha/* 接口并按保护规则拦截其他请求，相当于 Handler 与 Protect 的组合
 func (f *FastGoCaptcha) Middleware(next http.Handler) http.Handler {
+	protect := f.Protect(next)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		skipped := f.HandleFastGoCaptcha(w, r)
 		if !skipped {
 			return
 		}
+		protect.ServeHTTP(w, r)
+	})
+}
 
-		f.logInfof("checking protected for: %s", r.URL.Path)
+// Handler 只提供 /fastgocaptcha/* 接口（资源、验证码、校验、挑战页面），不检查保护规则，
+// 可以单独挂载到 http.ServeMux 或其他路由上，其他路径返回 404
+func (f *FastGoCaptcha) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		skipped := f.HandleFastGoCaptcha(w, r)
+		if !skipped {
+			return
+		}
+		f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "not found"))
+	})
+}
+
+// Protect 只按保护规则拦截请求，通过后交给 next，不提供 /fastgocaptcha/* 接口，
+// 需要另外挂载 Handler，next 为 nil 时返回 404
+func (f *FastGoCaptcha) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.logDebug("checking protected", "path", r.URL.Path)
+		if f.rejectBanned(w, r) {
+			return
+		}
 		if next != nil {
 			// match route and check
 			protected, matcher := f.CheckProtectMatcher(r.URL.Path)
+			if protected && f.isAllowlisted(r) {
+				f.logDebug("allowlisted, skip captcha", "path", r.URL.Path, "client_ip", clientIP(r))
+				f.emitEvent(r, &Event{Type: EventBypass, Reason: bypassAllowlist})
+				next.ServeHTTP(w, r)
+				return
+			}
 			if protected {
-				f.logInfof("protected: %s, matcher: %v", r.URL.Path, matcher.glob)
+				f.logDebug("protected", "path", r.URL.Path, "matcher", matcher.rawRoute)
+				if f.rejectFingerprintMismatch(w, r) {
+					return
+				}
 				if id, ok, updatedExpiresAt := f.NoNeedCaptcha(r); ok {
-					f.logInfof("no need captcha temporarily, skip, session: %v, path: %v", id, r.URL.Path)
+					f.logDebug("session is verified, skip captcha", "session_id", f.hashSessionID(id), "path", r.URL.Path)
 					if updatedExpiresAt {
 
 					}
-					next.ServeHTTP(w, r)
+					f.emitEvent(r, &Event{Type: EventBypass, SessionID: id, Reason: bypassVerified})
+					next.ServeHTTP(w, f.restoreStashedRequest(r))
 					return
 				}
 				// check captcha
-				f.logInfof("captcha need, start to check session's captcha")
+				f.logDebug("captcha required, check session captcha", "path", r.URL.Path)
 				captchaID, err := f.GetCaptchaIDFromSession(r)
 				if err != nil || captchaID == "" {
-					f.logInfof("captchaID not found, create new captcha")
-					captchaID := uuid.New().String()
-					rawData, data, err := f.createCaptchaJSON(captchaID)
+					f.logDebug("session captcha not found, create new captcha", "path", r.URL.Path)
+					captchaID, err := f.issueCaptcha()
 					if err != nil {
-						w.WriteHeader(http.StatusInternalServerError)
-						w.Write([]byte("FastGoCaptcha:Failed to create captcha data"))
+						f.logError("failed to create captcha data", "error", err)
+						f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to create captcha data"))
 						return
 					}
-					f.storeGoCaptchaData(captchaID, &SlideBlockWrapper{
-						data:    data,
-						rawData: rawData,
-					})
-					f.logInfof("create new captcha, store to session, redirect to captcha page")
+					if f.wantsJSONChallenge(r) {
+						f.logDebug("respond json challenge", "captcha_id", captchaID, "path", r.URL.Path)
+						session, err := f.createSessionWithCaptchaID(w, r, captchaID)
+						if err != nil {
+							f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to create session"))
+							return
+						}
+						f.emitEvent(r, &Event{Type: EventChallengeIssued, SessionID: session.id, CaptchaID: captchaID, Challenge: ChallengeTypeJSON})
+						f.writeJSONChallenge(w, r, matcher, captchaID)
+						return
+					}
+					f.logDebug("redirect to challenge page", "captcha_id", captchaID, "path", r.URL.Path)
 					f.CreateSessionWithCaptchaIDAndRedirect(w, r, captchaID)
 					return
 				}
 
 				x := r.URL.Query().Get("fastgocaptcha_x")
 				if x == "" {
-					w.Header().Set("Content-Type", "text/html; charset=utf-8")
-					authPath := `/fastgocaptcha/session/captcha?fastgocaptcha_path=` + url.QueryEscape(r.URL.Path)
+					if f.wantsJSONChallenge(r) {
+						f.writeJSONChallenge(w, r, matcher, captchaID)
+						return
+					}
+					if pathedSession, err := f.GetCaptchaSession(r); err == nil {
+						f.stashRequest(r, pathedSession)
+					}
+					authPath := f.challengeURL("/fastgocaptcha/session/captcha", r.URL.Path, r.URL.RequestURI())
 					w.Header().Set("X-FastGoCaptcha-Auth", authPath)
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte(
-						"<html><body>" +
-							"This route requires a x value(fastgocaptcha_x), view <a href='/fastgocaptcha/session/captcha?fastgocaptcha_path=" + url.QueryEscape(r.URL.Path) + "'>here</a>" +
-							" for auth it! or with query param fastgocaptcha_x" +
-							"</body></html>"))
+					e := newError(f.challengeStatusCode, ErrCaptchaRequired, "this route requires captcha verification, open the challenge page or pass fastgocaptcha_x")
+					e.link = authPath
+					f.writeError(w, r, e)
 					return
 				}
 
-				xInt, err := strconv.Atoi(x)
-				if err != nil {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("FastGoCaptcha:Invalid x value"))
+				captchaData, ok := f.loadGoCaptchaData(captchaID)
+				// 每个验证码只能尝试一次，无论成败都删除，防止重放和逐步枚举 x
+				f.deleteGoCaptchaData(captchaID)
+				if !ok || captchaData == nil {
+					f.verifyFailed(w, r, nil, captchaID, newError(http.StatusBadRequest, ErrExpired, "captcha expired or invalid"))
 					return
 				}
 
-				captchaData, ok := f.loadGoCaptchaData(captchaID)
-				if !ok {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("FastGoCaptcha:Captcha ID is invalid, no captcha data found"))
+				xValue, verr := parseX(x)
+				if verr != nil {
+					f.verifyFailed(w, r, captchaData, captchaID, verr)
+					return
+				}
+				xInt, verr := checkX(xValue, captchaData)
+				if verr != nil {
+					f.verifyFailed(w, r, captchaData, captchaID, verr)
 					return
 				}
 
 				if abs(captchaData.data.X-xInt) > 10 {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("FastGoCaptcha:Verification failed"))
+					f.verifyFailed(w, r, captchaData, captchaID, newError(http.StatusBadRequest, ErrWrongAnswer, "verification failed"))
 					return
 				}
 
-				// 用完即删，防止重放攻击
-				f.deleteGoCaptchaData(captchaID)
+				f.emitEvent(r, &Event{Type: EventVerifySuccess, CaptchaID: captchaID, Latency: captchaData.age()})
 				next.ServeHTTP(w, r)
 				return
 			}
 			next.ServeHTTP(w, r)
 		} else {
-			w.WriteHeader(http.StatusNotFound)
+			f.writeError(w, r, newError(http.StatusNotFound, ErrNotFound, "not found"))
 		}
 	})
 }
@@ -349,6 +600,22 @@ func (f *FastGoCaptcha) HandleFastGoCaptcha(w http.ResponseWriter, r *http.Reque
 		removePrefix = "/" + removePrefix
 	}
 
+	if isReservedRoute(removePrefix) && f.handleCORS(w, r) {
+		return false
+	}
+
+	if strings.HasPrefix(removePrefix, "/fastgocaptcha/assets/") {
+		f.serveChallengeAssets(w, r, strings.TrimPrefix(removePrefix, "/fastgocaptcha/assets/"))
+		return false
+	}
+
+	switch removePrefix {
+	case "/fastgocaptcha/verify", "/fastgocaptcha/captcha", "/fastgocaptcha/session/captcha", "/fastgocaptcha/auth/challenge":
+		if f.rejectBanned(w, r) {
+			return false
+		}
+	}
+
 	skipped = true
 	switch removePrefix {
 	case "/fastgocaptcha/resources/fastgocaptcha.js":
@@ -363,101 +630,120 @@ func (f *FastGoCaptcha) HandleFastGoCaptcha(w http.ResponseWriter, r *http.Reque
 		skipped = false
 		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
 		w.Write(gocaptchaGlobalJS)
+	case "/fastgocaptcha/resources/fastgocaptcha.css":
+		skipped = false
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Write(fastgocaptchaCSS)
+	case "/fastgocaptcha/resources/challenge.js":
+		skipped = false
+		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+		w.Write(challengeJS)
+	case "/fastgocaptcha/resources/challenge.css":
+		skipped = false
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Write(challengeCSS)
+	case "/fastgocaptcha/resources/fastgocaptcha.i18n.js":
+		skipped = false
+		f.serveI18nScript(w, r)
+	case "/fastgocaptcha/auth":
+		skipped = false
+		f.serveForwardAuth(w, r)
+	case "/fastgocaptcha/auth/challenge":
+		skipped = false
+		f.serveForwardAuthChallenge(w, r)
+	case "/fastgocaptcha/auth/return":
+		skipped = false
+		f.serveForwardAuthReturn(w, r)
 	case "/fastgocaptcha/verify":
 		skipped = false
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			f.verifyFailed(w, r, nil, "", newError(http.StatusMethodNotAllowed, ErrMethodNotAllowed, "method %s is not allowed", r.Method))
+			return
+		}
+		if err := f.checkVerifyOrigin(r); err != nil {
+			f.logWarning("reject verify request", "client_ip", clientIP(r), "error", err)
+			f.verifyFailed(w, r, nil, "", newError(http.StatusForbidden, ErrCrossSite, "cross-site verify request is not allowed"))
 			return
 		}
 
-		contentType := r.Header.Get("Content-Type")
-		var id, xStr string
-		var err error
-
-		tolower := strings.ToLower(contentType)
-		switch {
-		case strings.HasPrefix(tolower, "application/x-www-form-urlencoded"):
-			id = r.FormValue("id")
-			xStr = r.FormValue("x")
-		case strings.HasPrefix(tolower, "multipart/form-data"):
-			if err := r.ParseMultipartForm(32 << 20); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				w.Write([]byte("FastGoCaptcha:Failed to parse multipart form"))
-				return
-			}
-			id = r.FormValue("id")
-			xStr = r.FormValue("x")
-		case strings.HasPrefix(tolower, "application/json"), strings.HasPrefix(tolower, "text/json"), strings.HasPrefix(tolower, "application/x-json"):
-			var data struct {
-				ID string `json:"id"`
-				X  string `json:"x"`
-			}
-			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				w.Write([]byte("FastGoCaptcha:Failed to parse json body"))
-				return
-			}
-			id = data.ID
-			xStr = data.X
-		default:
-			w.WriteHeader(http.StatusUnsupportedMediaType)
+		req, verr := f.parseVerifyRequest(w, r)
+		if verr != nil {
+			f.logInfo("invalid verify request", "client_ip", clientIP(r), "error", verr)
+			f.verifyFailed(w, r, nil, "", verr)
 			return
 		}
+		id, returnTo := req.ID, req.ReturnTo
 
-		x, err := strconv.Atoi(xStr)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.Write([]byte("FastGoCaptcha:Invalid x value"))
+		if err := f.checkCSRFToken(r, req.CSRFToken); err != nil {
+			f.logWarning("reject verify request", "client_ip", clientIP(r), "error", err)
+			f.verifyFailed(w, r, nil, id, newError(http.StatusForbidden, ErrInvalidCSRFToken, "invalid csrf token"))
 			return
 		}
 
 		// 获取存储的验证码信息
 		info, ok := f.loadGoCaptchaData(id)
 		if !ok {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.Write([]byte("FastGoCaptcha:Captcha expired or invalid"))
+			f.verifyFailed(w, r, nil, id, newError(http.StatusBadRequest, ErrExpired, "captcha expired or invalid"))
 			return
 		}
 
-		// 用完即删，防止重放攻击
-		defer f.deleteGoCaptchaData(id)
-
 		// 验证滑动结果
 		if info == nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.Write([]byte("FastGoCaptcha:Invalid captcha data"))
+			f.verifyFailed(w, r, nil, id, newError(http.StatusInternalServerError, ErrInternal, "invalid captcha data"))
+			return
+		}
+
+		// 绑定了会话的验证码只能由该会话提交，且不删除，避免他人消耗掉别人的验证码
+		if !f.captchaOwnedBy(info, r) {
+			f.logWarning("captcha submitted by a foreign session", "captcha_id", id, "client_ip", clientIP(r))
+			f.verifyFailed(w, r, info, id, newError(http.StatusForbidden, ErrForeignSession, "captcha was issued to another session"))
 			return
 		}
 
+		x, verr := checkX(req.X, info)
+		if verr != nil {
+			f.verifyFailed(w, r, info, id, verr)
+			return
+		}
+
+		// 用完即删，防止重放攻击
+		defer f.deleteGoCaptchaData(id)
+
 		// 允许一定的误差范围（10像素）
 		targetX := info.data.X
 		if abs(x-targetX) <= 10 {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
+			result := map[string]interface{}{
 				"success": true,
 				"message": "Verification successful",
-			})
-			f.logInfof("verification successful, update session's captcha times to 1")
+			}
+			if returnTo != "" {
+				if target, err := f.VerifyReturnTo(returnTo); err == nil {
+					result["return_to"] = target
+				} else {
+					f.logWarning("ignore invalid return_to", "error", err)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+			f.emitEvent(r, &Event{Type: EventVerifySuccess, CaptchaID: id, Latency: info.age()})
+			if !f.isSessionCaptcha(r, id) {
+				// 独立使用的验证码只返回校验结果，不会让会话通过保护规则
+				f.logDebug("captcha is not bound to the session path", "captcha_id", id)
+				return
+			}
+			f.logDebug("mark session verified", "captcha_id", id)
 			f.UpdateSessionCaptchaTimes(r, 1)
+			f.bindFingerprint(r)
 			newPath, _ := f.GetCaptchaRequiredPath(r)
 			if newPath != "" {
 				protected, matcher := f.CheckProtectMatcher(newPath)
 				if protected {
-					f.logInfof("verification successful, update session's captcha expires at to %v", matcher.timeout)
+					f.logDebug("extend session verification", "captcha_id", id, "matcher", matcher.rawRoute, "timeout", matcher.timeout)
 					f.UpdateSessionCaptchaExpiresAt(r, matcher.timeout)
 				}
 			}
 		} else {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "Verification failed",
-			})
+			f.verifyFailed(w, r, info, id, newError(http.StatusBadRequest, ErrWrongAnswer, "verification failed"))
 		}
 		return
 	case "/fastgocaptcha/session/captcha":
@@ -465,79 +751,103 @@ func (f *FastGoCaptcha) HandleFastGoCaptcha(w http.ResponseWriter, r *http.Reque
 
 		id, _ := f.GetCaptchaIDFromSession(r)
 		if id == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.Write([]byte("FastGoCaptcha:Captcha ID is invalid, session is not created"))
+			f.writeError(w, r, newError(http.StatusBadRequest, ErrSessionNotFound, "captcha session is not created"))
 			return
 		}
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write(testPage)
+		f.serveChallengePage(w, r)
 		return
 	case "/fastgocaptcha/captcha":
 		skipped = false
 
+		// 验证码 ID 只能由服务端生成，不接受客户端指定的 id
+		sessionID, _ := f.sessionCookieValue(r)
 		id, err := f.GetCaptchaIDFromSession(r)
 		if err != nil || id == "" {
-			id = strings.TrimSpace(r.URL.Query().Get("id"))
-			if id == "" {
-				f.logWarningf("captchaID not found, create new captcha, this should not happen, nonsense")
-				id = uuid.New().String()
+			if r.URL.Query().Has("id") {
+				f.logWarning("ignore client supplied captcha id", "client_ip", clientIP(r))
 			}
+			id = uuid.New().String()
+			sessionID = ""
 		}
 
-		f.logInfof("captchaID: %s, start to load captcha data", id)
+		f.logDebug("load captcha data", "captcha_id", id)
 		dotDataWrapper, ok := f.loadGoCaptchaData(id)
 		if !ok || dotDataWrapper == nil {
-			f.logInfof("captchaID: %s, captcha data not found, create new captcha", id)
-			raw, dotData, err := f.createCaptchaJSON(id)
+			f.logDebug("captcha data not found, create new captcha", "captcha_id", id)
+			dotDataWrapper, err = f.createCaptchaJSON(id)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				w.Write([]byte("FastGoCaptcha:Failed to create captcha data"))
+				f.logError("failed to create captcha data", "error", err)
+				f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to create captcha data"))
 				return
 			}
-			dotDataWrapper = &SlideBlockWrapper{
-				data:    dotData,
-				rawData: raw,
-			}
+			dotDataWrapper.sessionID = sessionID
 			f.storeGoCaptchaData(id, dotDataWrapper)
+			f.emitEvent(r, &Event{Type: EventChallengeIssued, CaptchaID: id, Challenge: ChallengeTypeWidget})
 			go func() {
 				time.Sleep(f.sessionTimeout)
 				f.deleteGoCaptchaData(id)
 			}()
 		}
 
-		f.logInfof("captchaID: %s, start to check protect matcher", id)
+		raw := dotDataWrapper.rawData
+		if f.verifyCSRF {
+			token, err := f.issueCSRFToken(w, r)
+			if err == nil {
+				raw, err = withCSRFToken(raw, token)
+			}
+			if err != nil {
+				f.logError("failed to issue csrf token", "error", err)
+				f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to issue csrf token"))
+				return
+			}
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.Write(dotDataWrapper.rawData)
+		w.Write(raw)
 	default:
 		skipped = true
 	}
 	return skipped
 }
 
-func (f *FastGoCaptcha) createCaptchaJSON(id string) ([]byte, *slide.Block, error) {
+// issueCaptcha 生成并保存一个新的验证码，返回验证码 ID
+func (f *FastGoCaptcha) issueCaptcha() (string, error) {
+	captchaID := uuid.New().String()
+	data, err := f.createCaptchaJSON(captchaID)
+	if err != nil {
+		return "", err
+	}
+	f.storeGoCaptchaData(captchaID, data)
+	return captchaID, nil
+}
+
+func (f *FastGoCaptcha) createCaptchaJSON(id string) (*SlideBlockWrapper, error) {
+	start := time.Now()
 	captData, err := f.slideCaptcha.Generate()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate captcha: %v", err)
+		f.metrics.inc(metricGenerateFail)
+		f.stats.recordGeneration(0, err)
+		return nil, fmt.Errorf("failed to generate captcha: %v", err)
 	}
 	dotData := captData.GetData()
 	if dotData == nil {
-		return nil, nil, fmt.Errorf("failed to generate captcha in captData.GetData()")
+		return nil, fmt.Errorf("failed to generate captcha in captData.GetData()")
 	}
-	imageBase64, err := captData.GetMasterImage().ToBase64()
+	masterImage := captData.GetMasterImage().Get()
+	imageBase64, err := f.captchaImage.encode(masterImage)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate captcha incaptData.GetMasterImage().ToBase64(): %v", err)
+		return nil, fmt.Errorf("failed to encode captcha image: %v", err)
 	}
 
 	thumbBase64, err := captData.GetTileImage().ToBase64()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate captcha in captData.GetTileImage().ToBase64(): %v", err)
+		return nil, fmt.Errorf("failed to generate captcha in captData.GetTileImage().ToBase64(): %v", err)
 	}
 
 	raw, err := json.Marshal(map[string]any{
 		"fastgocaptcha_id":           fmt.Sprint(id),
 		"fastgocaptcha_image_base64": imageBase64,
+		"fastgocaptcha_image_width":  masterImage.Bounds().Dx(),
+		"fastgocaptcha_image_height": masterImage.Bounds().Dy(),
 		"fastgocaptcha_thumb_base64": thumbBase64,
 		"fastgocaptcha_thumb_width":  dotData.Width,
 		"fastgocaptcha_thumb_height": dotData.Height,
@@ -545,9 +855,16 @@ func (f *FastGoCaptcha) createCaptchaJSON(id string) ([]byte, *slide.Block, erro
 		"fastgocaptcha_thumb_y":      dotData.TileY,
 	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal captcha data: %v", err)
+		return nil, fmt.Errorf("failed to marshal captcha data: %v", err)
 	}
-	return raw, dotData, nil
+	f.metrics.observe(metricGeneration, time.Since(start))
+	f.stats.recordGeneration(time.Since(start), nil)
+	return &SlideBlockWrapper{
+		data:       dotData,
+		rawData:    raw,
+		imageWidth: masterImage.Bounds().Dx(),
+		createdAt:  time.Now(),
+	}, nil
 }
 
 // abs 计算绝对值
@@ -0,0 +1,172 @@
+package fastgocaptcha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// FingerprintIPMode 决定客户端 IP 如何参与指纹
+type FingerprintIPMode string
+
+const (
+	// FingerprintIPNone 不绑定 IP
+	FingerprintIPNone FingerprintIPMode = ""
+	// FingerprintIPExact 绑定完整 IP
+	FingerprintIPExact FingerprintIPMode = "exact"
+	// FingerprintIPPrefix 绑定 IP 所在网段，默认 IPv4 /24、IPv6 /64，容忍移动网络和 NAT 下的地址变化
+	FingerprintIPPrefix FingerprintIPMode = "prefix"
+)
+
+// FingerprintAction 决定指纹不一致时的处理方式
+type FingerprintAction string
+
+const (
+	// FingerprintRechallenge 视为未验证，重新弹出验证码，验证通过后绑定到新的指纹
+	FingerprintRechallenge FingerprintAction = ""
+	// FingerprintReject 直接返回 403，原客户端的验证状态不受影响
+	FingerprintReject FingerprintAction = "reject"
+)
+
+// FingerprintConfig 配置已验证会话与客户端指纹的绑定，防止验证后的 cookie 被复制给其他客户端使用
+type FingerprintConfig struct {
+	IP FingerprintIPMode
+	// IPv4PrefixLen/IPv6PrefixLen 在 FingerprintIPPrefix 下使用，默认 24 和 64
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+	// TrustProxyHeaders 从 X-Forwarded-For（以及 WithTrustedProxies 中代理发送的 X-Real-IP）读取客户端 IP，只应在反向代理之后开启
+	TrustProxyHeaders bool
+	// UserAgent 绑定 User-Agent 的哈希
+	UserAgent bool
+	// TLS 绑定 TLS 版本、密码套件、ALPN 和 SNI，只在本服务直接终止 TLS 时有效
+	TLS        bool
+	OnMismatch FingerprintAction
+}
+
+// WithFingerprintBinding 验证成功时记录客户端指纹，之后的请求指纹不一致时按 OnMismatch 处理
+func WithFingerprintBinding(config FingerprintConfig) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.fingerprint = &config
+	}
+}
+
+func (f *FastGoCaptcha) initFingerprint() error {
+	if f.fingerprint == nil {
+		return nil
+	}
+	c := f.fingerprint
+	switch c.IP {
+	case FingerprintIPNone, FingerprintIPExact, FingerprintIPPrefix:
+	default:
+		return fmt.Errorf("invalid fingerprint ip mode: %s", c.IP)
+	}
+	switch c.OnMismatch {
+	case FingerprintRechallenge, FingerprintReject:
+	default:
+		return fmt.Errorf("invalid fingerprint mismatch action: %s", c.OnMismatch)
+	}
+	if c.IPv4PrefixLen == 0 {
+		c.IPv4PrefixLen = 24
+	}
+	if c.IPv6PrefixLen == 0 {
+		c.IPv6PrefixLen = 64
+	}
+	if c.IPv4PrefixLen < 0 || c.IPv4PrefixLen > 32 || c.IPv6PrefixLen < 0 || c.IPv6PrefixLen > 128 {
+		return fmt.Errorf("invalid fingerprint ip prefix length: /%d, /%d", c.IPv4PrefixLen, c.IPv6PrefixLen)
+	}
+	if c.IP == FingerprintIPNone && !c.UserAgent && !c.TLS {
+		return fmt.Errorf("fingerprint binding needs at least one of ip, user agent or tls")
+	}
+	return nil
+}
+
+// clientFingerprint 计算请求的客户端指纹，未开启绑定时返回空字符串
+func (f *FastGoCaptcha) clientFingerprint(r *http.Request) string {
+	c := f.fingerprint
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	if c.IP != FingerprintIPNone {
+		ip := clientIP(r)
+		if c.TrustProxyHeaders {
+			if forwarded := f.forwardedClientIP(r); forwarded != "" {
+				ip = forwarded
+			}
+		}
+		if c.IP == FingerprintIPPrefix {
+			ip = ipPrefix(ip, c.IPv4PrefixLen, c.IPv6PrefixLen)
+		}
+		parts = append(parts, "ip="+ip)
+	}
+	if c.UserAgent {
+		parts = append(parts, "ua="+r.UserAgent())
+	}
+	if c.TLS {
+		if r.TLS != nil {
+			parts = append(parts, "tls="+strconv.Itoa(int(r.TLS.Version))+"/"+strconv.Itoa(int(r.TLS.CipherSuite))+
+				"/"+r.TLS.NegotiatedProtocol+"/"+strings.ToLower(r.TLS.ServerName))
+		} else {
+			parts = append(parts, "tls=none")
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+func ipPrefix(raw string, v4, v6 int) string {
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return raw
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(v4, 32)), Mask: net.CIDRMask(v4, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(v6, 128)), Mask: net.CIDRMask(v6, 128)}).String()
+}
+
+// fingerprintMatches 检查会话绑定的指纹，会话没有绑定指纹时总是通过
+func (f *FastGoCaptcha) fingerprintMatches(pathedSession *PathedSession, r *http.Request) bool {
+	if f.fingerprint == nil {
+		return true
+	}
+	pathedSession.mutex.Lock()
+	bound := pathedSession.fingerprint
+	pathedSession.mutex.Unlock()
+	if bound == "" || bound == f.clientFingerprint(r) {
+		return true
+	}
+	f.logWarning("session fingerprint changed", "session_id", f.hashSessionID(pathedSession.id), "path", pathedSession.path, "client_ip", clientIP(r))
+	return false
+}
+
+// rejectFingerprintMismatch 在 FingerprintReject 模式下拒绝指纹不一致的请求，返回 true 表示已经响应
+func (f *FastGoCaptcha) rejectFingerprintMismatch(w http.ResponseWriter, r *http.Request) bool {
+	if f.fingerprint == nil || f.fingerprint.OnMismatch != FingerprintReject {
+		return false
+	}
+	pathedSession, err := f.GetCaptchaSession(r)
+	if err != nil || f.fingerprintMatches(pathedSession, r) {
+		return false
+	}
+	f.writeError(w, r, newError(http.StatusForbidden, ErrFingerprintMismatch, "session is bound to another client"))
+	return true
+}
+
+// bindFingerprint 在验证成功后把会话绑定到当前客户端
+func (f *FastGoCaptcha) bindFingerprint(r *http.Request) {
+	if f.fingerprint == nil {
+		return
+	}
+	pathedSession, err := f.GetCaptchaSession(r)
+	if err != nil {
+		return
+	}
+	pathedSession.mutex.Lock()
+	pathedSession.fingerprint = f.clientFingerprint(r)
+	pathedSession.mutex.Unlock()
+}
@@ -0,0 +1,222 @@
+package fastgocaptcha
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithForwardAuthStatusCode 设置 /fastgocaptcha/auth 拒绝请求时的状态码，默认 401；
+// Traefik/Caddy 会把 forward auth 的响应直接返回给浏览器，此时可以使用 http.StatusFound
+func WithForwardAuthStatusCode(code int) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.forwardAuthStatusCode = code
+	}
+}
+
+// WithTrustedProxies 设置可信的反向代理地址（IP 或 CIDR）。来自可信代理的请求才会使用 X-Real-IP，
+// 并跳过 X-Forwarded-For 末尾属于可信代理的地址；其他请求忽略 X-Real-IP，只取 X-Forwarded-For 中最后一个地址
+func WithTrustedProxies(proxies ...string) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.trustedProxies = append(f.trustedProxies, proxies...)
+	}
+}
+
+func (f *FastGoCaptcha) initTrustedProxies() error {
+	f.trustedProxyNets = nil
+	for _, raw := range f.trustedProxies {
+		ipNet, err := parseAllowIP(raw)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy: %v", err)
+		}
+		f.trustedProxyNets = append(f.trustedProxyNets, ipNet)
+	}
+	return nil
+}
+
+func (f *FastGoCaptcha) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range f.trustedProxyNets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedRequest 根据反向代理传来的 X-Original-* / X-Forwarded-* 头还原原始请求
+func (f *FastGoCaptcha) forwardedRequest(r *http.Request) (*http.Request, error) {
+	rawURI := firstHeader(r, "X-Original-URI", "X-Forwarded-Uri")
+	if rawURI == "" {
+		return nil, errors.New("X-Original-URI or X-Forwarded-Uri is required")
+	}
+	u, err := url.ParseRequestURI(rawURI)
+	if err != nil {
+		return nil, err
+	}
+
+	orig := r.Clone(r.Context())
+	orig.Method = firstHeader(r, "X-Original-Method", "X-Forwarded-Method")
+	if orig.Method == "" {
+		orig.Method = http.MethodGet
+	}
+	orig.URL = &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery}
+	orig.RequestURI = u.RequestURI()
+	if host := firstHeader(r, "X-Forwarded-Host"); host != "" {
+		orig.Host = host
+	}
+	if ip := f.forwardedClientIP(r); ip != "" {
+		orig.RemoteAddr = net.JoinHostPort(ip, "0")
+	}
+	orig.Body = http.NoBody
+	orig.ContentLength = 0
+	return orig, nil
+}
+
+func firstHeader(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(r.Header.Get(name)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// forwardedClientIP 从反向代理传来的头中取客户端 IP。
+// auth_request 子请求会带上客户端自己发送的头，所以只有直接连接的是可信代理时才使用 X-Real-IP；
+// 否则只使用 X-Forwarded-For 中最后一个地址，即直接连接的代理追加的地址
+func (f *FastGoCaptcha) forwardedClientIP(r *http.Request) string {
+	trusted := f.isTrustedProxy(clientIP(r))
+	if trusted {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(hops[i])
+		if net.ParseIP(ip) == nil {
+			return ""
+		}
+		// 可信代理链中继续向前查找，直到第一个不是可信代理的地址
+		if !trusted || i == 0 || !f.isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return ""
+}
+
+func withPath(r *http.Request, path string) *http.Request {
+	orig := r.Clone(r.Context())
+	orig.URL = &url.URL{Path: path}
+	return orig
+}
+
+// serveForwardAuth 处理 nginx auth_request、Traefik/Caddy forward_auth 的鉴权子请求
+func (f *FastGoCaptcha) serveForwardAuth(w http.ResponseWriter, r *http.Request) {
+	orig, err := f.forwardedRequest(r)
+	if err != nil {
+		f.logWarning("forward auth: invalid request", "error", err)
+		f.writeError(w, r, newError(http.StatusBadRequest, ErrMalformed, "%v", err))
+		return
+	}
+
+	if f.isBanned(orig) {
+		f.emitEvent(orig, &Event{Type: EventBanned})
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	protected, _ := f.CheckProtectMatcher(orig.URL.Path)
+	if !protected {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if f.isAllowlisted(orig) {
+		f.emitEvent(orig, &Event{Type: EventBypass, Reason: bypassAllowlist})
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if f.rejectFingerprintMismatch(w, orig) {
+		return
+	}
+	if id, ok, _ := f.NoNeedCaptcha(orig); ok {
+		f.logDebug("forward auth: session is verified", "session_id", f.hashSessionID(id), "path", orig.URL.Path)
+		f.emitEvent(orig, &Event{Type: EventBypass, SessionID: id, Reason: bypassVerified})
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	location := f.challengeURL("/fastgocaptcha/auth/challenge", orig.URL.Path, orig.URL.RequestURI())
+	f.logDebug("forward auth: captcha required", "method", orig.Method, "path", orig.URL.Path, "client_ip", clientIP(orig))
+	w.Header().Set("Location", location)
+	w.Header().Set("X-FastGoCaptcha-Auth", location)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(f.forwardAuthStatusCode)
+}
+
+// serveForwardAuthChallenge 为原始路径创建验证码会话，并跳转到挑战页面，验证成功后回到 /fastgocaptcha/auth/return
+func (f *FastGoCaptcha) serveForwardAuthChallenge(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("fastgocaptcha_path")
+	// 未携带 return_to 时会跳回 path，必须是站内相对路径，防止开放重定向
+	if _, ok := safeReturnPath(path); !ok {
+		f.writeError(w, r, newError(http.StatusBadRequest, ErrMalformed, "fastgocaptcha_path must be a relative path"))
+		return
+	}
+	_, target := f.returnToFromQuery(r.URL.Query())
+	if target == "" {
+		target = path
+	}
+
+	orig := withPath(r, path)
+	if protected, _ := f.CheckProtectMatcher(path); !protected || f.isVerified(orig) {
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	if captchaID, err := f.GetCaptchaIDFromSession(orig); err != nil || captchaID == "" {
+		captchaID, err = f.issueCaptcha()
+		if err != nil {
+			f.logError("forward auth: failed to create captcha", "error", err)
+			f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to create captcha data"))
+			return
+		}
+		session, err := f.createSessionWithCaptchaID(w, orig, captchaID)
+		if err != nil {
+			f.writeError(w, r, newError(http.StatusInternalServerError, ErrInternal, "failed to create session"))
+			return
+		}
+		f.emitEvent(orig, &Event{Type: EventChallengeIssued, SessionID: session.id, CaptchaID: captchaID, Challenge: ChallengeTypeForwardAuth})
+	}
+
+	returnURL := f.challengeURL("/fastgocaptcha/auth/return", path, target)
+	http.Redirect(w, r, f.challengeURL("/fastgocaptcha/session/captcha", path, returnURL), http.StatusFound)
+}
+
+// serveForwardAuthReturn 验证成功后跳回原始地址，未验证时重新发起挑战
+func (f *FastGoCaptcha) serveForwardAuthReturn(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("fastgocaptcha_path")
+	// 未携带 return_to 时会跳回 path，必须是站内相对路径，防止开放重定向
+	if _, ok := safeReturnPath(path); !ok {
+		f.writeError(w, r, newError(http.StatusBadRequest, ErrMalformed, "fastgocaptcha_path must be a relative path"))
+		return
+	}
+	_, target := f.returnToFromQuery(r.URL.Query())
+	if target == "" {
+		target = path
+	}
+	if protected, _ := f.CheckProtectMatcher(path); !protected || f.isVerified(withPath(r, path)) {
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, f.challengeURL("/fastgocaptcha/auth/challenge", path, target), http.StatusFound)
+}
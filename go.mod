@@ -7,6 +7,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/wenlng/go-captcha-assets v1.0.5
 	github.com/wenlng/go-captcha/v2 v2.0.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
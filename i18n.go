@@ -0,0 +1,168 @@
+package fastgocaptcha
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultLocale = "en"
+
+// MessageCatalog 保存同一种语言下挑战页面和 fastgocaptcha.js 使用的文案
+type MessageCatalog map[string]string
+
+var builtinCatalogs = map[string]MessageCatalog{
+	"en": {
+		"page_title":      "FastGoCaptcha Slide-Captcha Verification Page",
+		"page_heading":    "Slide-Captcha Verification",
+		"page_path":       "Current Verification Path",
+		"page_success":    "Verification Successful!",
+		"page_error":      "Verification Failed, Please Try Again",
+		"page_reloading":  "Verification failed. Please try again. Reloading in {seconds} seconds...",
+		"page_cancelled":  "Verification cancelled",
+		"title":           "Please complete the slide verification",
+		"loading":         "Loading...",
+		"slide":           "Drag the slider to complete the puzzle",
+		"success":         "Verification successful",
+		"error":           "Verification failed",
+		"refresh":         "Refresh captcha",
+		"load_failed":     "Failed to load captcha, please refresh and try again",
+		"verify_failed":   "Verification failed, please try again",
+		"request_failed":  "Verification request failed, please try again",
+		"component_error": "Failed to load captcha component",
+	},
+	"zh": {
+		"page_title":      "FastGoCaptcha 滑动验证",
+		"page_heading":    "滑动验证",
+		"page_path":       "当前验证路径",
+		"page_success":    "验证成功！",
+		"page_error":      "验证失败，请重试",
+		"page_reloading":  "验证失败，请重试。{seconds} 秒后刷新...",
+		"page_cancelled":  "已取消验证",
+		"title":           "请完成滑动验证",
+		"loading":         "加载中...",
+		"slide":           "请拖动滑块完成拼图",
+		"success":         "验证成功",
+		"error":           "验证失败",
+		"refresh":         "刷新验证码",
+		"load_failed":     "验证码加载失败，请刷新重试",
+		"verify_failed":   "验证失败，请重试",
+		"request_failed":  "验证请求失败，请重试",
+		"component_error": "加载验证组件失败",
+	},
+}
+
+// WithMessageCatalog 添加或覆盖某种语言的文案，未提供的 key 使用内置英文文案
+func WithMessageCatalog(locale string, messages MessageCatalog) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		if f.catalogs == nil {
+			f.catalogs = make(map[string]MessageCatalog)
+		}
+		locale = normalizeLocale(locale)
+		catalog := make(MessageCatalog)
+		for k, v := range f.catalogs[locale] {
+			catalog[k] = v
+		}
+		for k, v := range messages {
+			catalog[k] = v
+		}
+		f.catalogs[locale] = catalog
+	}
+}
+
+// WithDefaultLocale 设置 Accept-Language 无法匹配时使用的语言
+func WithDefaultLocale(locale string) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.defaultLocale = normalizeLocale(locale)
+	}
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func (f *FastGoCaptcha) initCatalogs() {
+	catalogs := make(map[string]MessageCatalog, len(builtinCatalogs)+len(f.catalogs))
+	for locale, messages := range builtinCatalogs {
+		catalogs[locale] = messages
+	}
+	for locale, messages := range f.catalogs {
+		merged := make(MessageCatalog)
+		for k, v := range builtinCatalogs[defaultLocale] {
+			merged[k] = v
+		}
+		for k, v := range builtinCatalogs[locale] {
+			merged[k] = v
+		}
+		for k, v := range messages {
+			merged[k] = v
+		}
+		catalogs[locale] = merged
+	}
+	f.catalogs = catalogs
+	if f.defaultLocale == "" {
+		f.defaultLocale = defaultLocale
+	}
+	if _, ok := f.catalogs[f.defaultLocale]; !ok {
+		f.defaultLocale = defaultLocale
+	}
+}
+
+// matchLocale 返回与 Accept-Language 最匹配的已知语言
+func (f *FastGoCaptcha) matchLocale(acceptLanguage string) string {
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := normalizeLocale(fields[0])
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{locale: locale, q: q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		if _, ok := f.catalogs[c.locale]; ok {
+			return c.locale
+		}
+		if base, _, ok := strings.Cut(c.locale, "-"); ok {
+			if _, ok := f.catalogs[base]; ok {
+				return base
+			}
+		}
+	}
+	return f.defaultLocale
+}
+
+func (f *FastGoCaptcha) requestLocale(r *http.Request) string {
+	if lang := normalizeLocale(r.URL.Query().Get("lang")); lang != "" {
+		if _, ok := f.catalogs[lang]; ok {
+			return lang
+		}
+	}
+	return f.matchLocale(r.Header.Get("Accept-Language"))
+}
+
+func (f *FastGoCaptcha) messages(locale string) MessageCatalog {
+	if catalog, ok := f.catalogs[locale]; ok {
+		return catalog
+	}
+	return f.catalogs[f.defaultLocale]
+}
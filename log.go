@@ -1,31 +1,148 @@
 package fastgocaptcha
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// WithLogger 使用 slog 输出结构化日志，常用字段有 session_id（会话 ID 的哈希）、captcha_id、path、matcher、client_ip、outcome；
+// 不设置时不输出日志
+func WithLogger(logger *slog.Logger) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.logger = logger
+	}
+}
+
+// SetInfof 使用 printf 风格的函数接收 Debug 和 Info 日志，会替换 WithLogger 设置的 logger，
+// 结构化字段以 key=value 的形式追加在消息后
 func (f *FastGoCaptcha) SetInfof(infof func(format string, v ...any)) {
 	f.infof = infof
+	f.usePrintfLogger()
 }
 
+// SetWarningf 使用 printf 风格的函数接收 Warn 日志，见 SetInfof
 func (f *FastGoCaptcha) SetWarningf(warningf func(format string, v ...any)) {
 	f.warningf = warningf
+	f.usePrintfLogger()
 }
 
+// SetErrorf 使用 printf 风格的函数接收 Error 日志，见 SetInfof
 func (f *FastGoCaptcha) SetErrorf(errorf func(format string, v ...any)) {
 	f.errorf = errorf
+	f.usePrintfLogger()
 }
 
-func (f *FastGoCaptcha) logInfof(format string, v ...any) {
-	if f.infof != nil {
-		f.infof(format, v...)
+func (f *FastGoCaptcha) usePrintfLogger() {
+	if f.logger != nil {
+		if _, ok := f.logger.Handler().(*printfHandler); ok {
+			return
+		}
 	}
+	f.logger = slog.New(&printfHandler{f: f})
 }
 
-func (f *FastGoCaptcha) logWarningf(format string, v ...any) {
-	if f.warningf != nil {
-		f.warningf(format, v...)
+func (f *FastGoCaptcha) log(level slog.Level, msg string, args ...any) {
+	if f.logger == nil {
+		return
 	}
+	f.logger.Log(context.Background(), level, msg, args...)
+}
+
+func (f *FastGoCaptcha) logDebug(msg string, args ...any) {
+	f.log(slog.LevelDebug, msg, args...)
+}
+
+func (f *FastGoCaptcha) logInfo(msg string, args ...any) {
+	f.log(slog.LevelInfo, msg, args...)
 }
 
-func (f *FastGoCaptcha) logErrorf(format string, v ...any) {
-	if f.errorf != nil {
-		f.errorf(format, v...)
+func (f *FastGoCaptcha) logWarning(msg string, args ...any) {
+	f.log(slog.LevelWarn, msg, args...)
+}
+
+func (f *FastGoCaptcha) logError(msg string, args ...any) {
+	f.log(slog.LevelError, msg, args...)
+}
+
+// printfHandler 把 slog 记录转成一行文本交给 SetInfof/SetWarningf/SetErrorf 设置的函数
+type printfHandler struct {
+	f      *FastGoCaptcha
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *printfHandler) printf(level slog.Level) func(format string, v ...any) {
+	switch {
+	case level >= slog.LevelError:
+		return h.f.errorf
+	case level >= slog.LevelWarn:
+		return h.f.warningf
+	default:
+		return h.f.infof
+	}
+}
+
+func (h *printfHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.printf(level) != nil
+}
+
+func (h *printfHandler) Handle(_ context.Context, record slog.Record) error {
+	printf := h.printf(record.Level)
+	if printf == nil {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(record.Message)
+	for _, attr := range h.attrs {
+		writePrintfAttr(&b, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		writePrintfAttr(&b, h.prefix, attr)
+		return true
+	})
+	printf("%s", b.String())
+	return nil
+}
+
+func (h *printfHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	next.attrs = append(next.attrs, h.attrs...)
+	for _, attr := range attrs {
+		next.attrs = append(next.attrs, slog.Attr{Key: h.prefix + attr.Key, Value: attr.Value})
+	}
+	return &next
+}
+
+func (h *printfHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.prefix = h.prefix + name + "."
+	return &next
+}
+
+func writePrintfAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, sub := range value.Group() {
+			writePrintfAttr(b, prefix, sub)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	s := value.String()
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
 	}
+	fmt.Fprintf(b, " %s%s=%s", prefix, attr.Key, s)
 }
@@ -0,0 +1,230 @@
+package fastgocaptcha
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	generationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+	solveBuckets      = []float64{0.5, 1, 2, 3, 5, 10, 20, 30, 60, 120}
+)
+
+type metricDesc struct {
+	name    string
+	kind    string
+	help    string
+	labels  []string
+	buckets []float64
+}
+
+// 输出顺序即 metrics 中的顺序
+var (
+	metricChallenges   = &metricDesc{name: "fastgocaptcha_challenges_issued_total", kind: "counter", help: "Captcha challenges issued.", labels: []string{"matcher", "type"}}
+	metricVerify       = &metricDesc{name: "fastgocaptcha_verifications_total", kind: "counter", help: "Captcha verifications by result and failure reason.", labels: []string{"matcher", "result", "reason"}}
+	metricBypass       = &metricDesc{name: "fastgocaptcha_bypass_total", kind: "counter", help: "Protected requests passed without a captcha.", labels: []string{"matcher", "reason"}}
+	metricRateLimited  = &metricDesc{name: "fastgocaptcha_rate_limited_total", kind: "counter", help: "Requests rejected by RejectRateLimited."}
+	metricBanned       = &metricDesc{name: "fastgocaptcha_banned_total", kind: "counter", help: "Requests rejected because the client is banned."}
+	metricSessions     = &metricDesc{name: "fastgocaptcha_sessions_created_total", kind: "counter", help: "Captcha sessions created."}
+	metricExpired      = &metricDesc{name: "fastgocaptcha_sessions_expired_total", kind: "counter", help: "Captcha sessions removed after the session timeout."}
+	metricGeneration   = &metricDesc{name: "fastgocaptcha_generation_seconds", kind: "histogram", help: "Time spent generating and encoding a captcha image.", buckets: generationBuckets}
+	metricGenerateFail = &metricDesc{name: "fastgocaptcha_generation_errors_total", kind: "counter", help: "Captcha generation failures."}
+	metricSolve        = &metricDesc{name: "fastgocaptcha_solve_seconds", kind: "histogram", help: "Time from issuing a captcha to solving it.", labels: []string{"matcher"}, buckets: solveBuckets}
+
+	metricDescs = []*metricDesc{
+		metricChallenges, metricVerify, metricBypass, metricRateLimited, metricBanned,
+		metricSessions, metricExpired, metricGeneration, metricGenerateFail, metricSolve,
+	}
+)
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// captchaMetrics 保存计数器和直方图，key 是已经格式化好的标签
+type captchaMetrics struct {
+	mutex      sync.Mutex
+	counters   map[*metricDesc]map[string]uint64
+	histograms map[*metricDesc]map[string]*histogram
+}
+
+func newCaptchaMetrics() *captchaMetrics {
+	return &captchaMetrics{
+		counters:   make(map[*metricDesc]map[string]uint64),
+		histograms: make(map[*metricDesc]map[string]*histogram),
+	}
+}
+
+func (m *captchaMetrics) inc(desc *metricDesc, values ...string) {
+	key := formatLabels(desc.labels, values)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	series, ok := m.counters[desc]
+	if !ok {
+		series = make(map[string]uint64)
+		m.counters[desc] = series
+	}
+	series[key]++
+}
+
+func (m *captchaMetrics) observe(desc *metricDesc, d time.Duration, values ...string) {
+	key := formatLabels(desc.labels, values)
+	v := d.Seconds()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	series, ok := m.histograms[desc]
+	if !ok {
+		series = make(map[string]*histogram)
+		m.histograms[desc] = series
+	}
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(desc.buckets))}
+		series[key] = h
+	}
+	for i, upper := range desc.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// record 根据生命周期事件更新指标
+func (m *captchaMetrics) record(e *Event) {
+	switch e.Type {
+	case EventChallengeIssued:
+		m.inc(metricChallenges, e.Matcher, string(e.Challenge))
+	case EventVerifySuccess:
+		m.inc(metricVerify, e.Matcher, "success", "")
+		if e.Latency > 0 {
+			m.observe(metricSolve, e.Latency, e.Matcher)
+		}
+	case EventVerifyFailure:
+		m.inc(metricVerify, e.Matcher, "failure", e.Reason)
+	case EventBypass:
+		m.inc(metricBypass, e.Matcher, e.Reason)
+	case EventRateLimited:
+		m.inc(metricRateLimited)
+	case EventBanned:
+		m.inc(metricBanned)
+	case EventSessionCreated:
+		m.inc(metricSessions)
+	case EventSessionExpired:
+		m.inc(metricExpired)
+	}
+}
+
+func formatLabels(names []string, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		if i < len(values) {
+			b.WriteString(escapeLabelValue(values[i]))
+		}
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func withLabel(labels string, extra string) string {
+	if labels == "" {
+		return "{" + extra + "}"
+	}
+	return "{" + labels + "," + extra + "}"
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *captchaMetrics) writeTo(w *bufio.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, desc := range metricDescs {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", desc.name, desc.help, desc.name, desc.kind)
+		if desc.kind == "counter" {
+			values := m.counters[desc]
+			if len(values) == 0 && len(desc.labels) == 0 {
+				// 没有标签的计数器始终输出 0，方便计算 rate
+				fmt.Fprintf(w, "%s 0\n", desc.name)
+			}
+			for _, labels := range sortedKeys(values) {
+				fmt.Fprintf(w, "%s%s %d\n", desc.name, braced(labels), values[labels])
+			}
+			continue
+		}
+		values := m.histograms[desc]
+		for _, labels := range sortedKeys(values) {
+			h := values[labels]
+			for i, upper := range desc.buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", desc.name, withLabel(labels, `le="`+formatFloat(upper)+`"`), h.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", desc.name, withLabel(labels, `le="+Inf"`), h.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", desc.name, braced(labels), formatFloat(h.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", desc.name, braced(labels), h.count)
+		}
+	}
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出指标，不要挂载到公开的路径上
+func (f *FastGoCaptcha) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		bw := bufio.NewWriter(w)
+		defer bw.Flush()
+
+		f.metrics.writeTo(bw)
+
+		fmt.Fprintf(bw, "# HELP fastgocaptcha_active_sessions Captcha sessions that have not expired.\n")
+		fmt.Fprintf(bw, "# TYPE fastgocaptcha_active_sessions gauge\n")
+		fmt.Fprintf(bw, "fastgocaptcha_active_sessions %d\n", f.activeSessions())
+
+		// 自定义存储的大小无法得知，只在使用内置存储时输出
+		if stored := f.outstandingCaptchas(); stored >= 0 {
+			fmt.Fprintf(bw, "# HELP fastgocaptcha_store_size Captchas held in the built-in store.\n")
+			fmt.Fprintf(bw, "# TYPE fastgocaptcha_store_size gauge\n")
+			fmt.Fprintf(bw, "fastgocaptcha_store_size %d\n", stored)
+		}
+	})
+}
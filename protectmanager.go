@@ -16,21 +16,42 @@ type PathedSession struct {
 
 	captchaAllowedTimes int
 	captchaExpiredAt    time.Time
+	// fingerprint 验证成功时绑定的客户端指纹，见 WithFingerprintBinding
+	fingerprint string
+
+	// mutex 保护 captchaID、验证次数、过期时间、指纹和保存的请求
+	mutex   sync.Mutex
+	stashed *stashedRequest
 }
 
 type FastGoCaptchaSession struct {
 	id        string
 	pathed    *sync.Map
+	createdAt time.Time
+
+	mutex     sync.Mutex
 	expiresAt time.Time
 }
 
+func (s *FastGoCaptchaSession) expired(now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return now.After(s.expiresAt)
+}
+
+// touch 会话 cookie 重新写入时顺延服务端的过期时间
+func (s *FastGoCaptchaSession) touch(timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expiresAt = time.Now().Add(timeout)
+}
+
 func (f *FastGoCaptcha) GetCaptchaRequiredPath(r *http.Request) (string, error) {
 	protected, _ := f.CheckProtectMatcher(r.URL.Path)
 	if protected {
 		return r.URL.Path, nil
 	}
 
-	f.logInfof("GetCaptchaRequiredPath: %s", r.URL.Path)
 	requireQueryPath := false
 	switch r.URL.Path {
 	case "/fastgocaptcha/session/captcha", "/fastgocaptcha/session/captcha/":
@@ -42,7 +63,6 @@ func (f *FastGoCaptcha) GetCaptchaRequiredPath(r *http.Request) (string, error)
 	}
 	if requireQueryPath {
 		queryPath := r.URL.Query().Get("fastgocaptcha_path")
-		f.logInfof("GetCaptchaRequiredPath: requireQueryPath, queryPath: %s", queryPath)
 		if queryPath == "" {
 			return "", errors.New("fastgocaptcha_path is not found")
 		}
@@ -52,25 +72,77 @@ func (f *FastGoCaptcha) GetCaptchaRequiredPath(r *http.Request) (string, error)
 }
 
 func (f *FastGoCaptcha) GetOrCreateSession(r *http.Request) *FastGoCaptchaSession {
-	var id string
-	cookie, err := r.Cookie("fastgocaptcha_session")
-	if err != nil {
-		id = uuid.New().String()
-	} else {
-		id = cookie.Value
+	if session, ok := f.loadSession(r); ok {
+		return session
+	}
+	// 不沿用客户端提供的会话 ID，避免会话固定
+	now := time.Now()
+	session := &FastGoCaptchaSession{
+		id:        uuid.New().String(),
+		pathed:    new(sync.Map),
+		createdAt: now,
+		expiresAt: now.Add(f.sessionTimeout),
+	}
+	f.sessionManager.Store(session.id, session)
+	f.emitEvent(r, &Event{Type: EventSessionCreated, SessionID: session.id})
+	return session
+}
+
+// loadSession 读取请求 cookie 对应的会话，已过期的会话会被清理
+func (f *FastGoCaptcha) loadSession(r *http.Request) (*FastGoCaptchaSession, bool) {
+	id, ok := f.sessionCookieValue(r)
+	if !ok {
+		return nil, false
 	}
 	sessionraw, ok := f.sessionManager.Load(id)
 	if !ok {
-		session := &FastGoCaptchaSession{
-			id:        id,
-			pathed:    new(sync.Map),
-			expiresAt: time.Now().Add(f.sessionTimeout),
-		}
-		f.sessionManager.Store(id, session)
-		return session
+		return nil, false
 	}
 	session := sessionraw.(*FastGoCaptchaSession)
-	return session
+	if session.expired(time.Now()) {
+		f.expireSession(r, session)
+		return nil, false
+	}
+	return session, true
+}
+
+func (f *FastGoCaptcha) expireSession(r *http.Request, session *FastGoCaptchaSession) {
+	// 并发清理时只有真正删除的一方触发事件
+	if _, loaded := f.sessionManager.LoadAndDelete(session.id); !loaded {
+		return
+	}
+	f.logDebug("session expired", "session_id", f.hashSessionID(session.id))
+	f.emitEvent(r, &Event{Type: EventSessionExpired, SessionID: session.id, Latency: time.Since(session.createdAt)})
+}
+
+// startSessionSweeper 定期清理过期的会话，返回停止函数
+func (f *FastGoCaptcha) startSessionSweeper() func() {
+	interval := f.sessionTimeout
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				f.sessionManager.Range(func(key, value any) bool {
+					if session, ok := value.(*FastGoCaptchaSession); ok && session.expired(now) {
+						f.expireSession(nil, session)
+					}
+					return true
+				})
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
 }
 
 func (f *FastGoCaptcha) GetCaptchaIDFromSession(r *http.Request) (string, error) {
@@ -78,25 +150,21 @@ func (f *FastGoCaptcha) GetCaptchaIDFromSession(r *http.Request) (string, error)
 	if err != nil {
 		return "", err
 	}
+	pathedSession.mutex.Lock()
+	defer pathedSession.mutex.Unlock()
 	return pathedSession.captchaID, nil
 }
 
 func (f *FastGoCaptcha) GetCaptchaSession(r *http.Request) (*PathedSession, error) {
-	cookie, err := r.Cookie("fastgocaptcha_session")
-	if err != nil {
-		return nil, errors.New("session is not found")
-	}
-	sessionID := cookie.Value
-	sessionraw, ok := f.sessionManager.Load(sessionID)
+	session, ok := f.loadSession(r)
 	if !ok {
 		return nil, errors.New("session is not found")
 	}
-	session := sessionraw.(*FastGoCaptchaSession)
 	newpath, err := f.GetCaptchaRequiredPath(r)
 	if err != nil {
 		return nil, err
 	}
-	load, ok := session.pathed.Load(newpath)
+	load, ok := session.pathed.Load(f.scopeKey(newpath))
 	if !ok {
 		return nil, errors.New("captcha is not required")
 	}
@@ -110,9 +178,15 @@ func (f *FastGoCaptcha) GetCaptchaSession(r *http.Request) (*PathedSession, erro
 func (f *FastGoCaptcha) NoNeedCaptcha(r *http.Request) (sessionId string, noNeedCaptcha bool, updateExpiresAt bool) {
 	pathedSession, err := f.GetCaptchaSession(r)
 	if err != nil {
-		f.logInfof("NoNeedCaptcha check pathedSession error: %v", err)
+		f.logDebug("no verified session", "path", r.URL.Path, "error", err)
 		return "", false, false
 	}
+	if !f.fingerprintMatches(pathedSession, r) {
+		return pathedSession.id, false, false
+	}
+	// 检查和扣减次数需要在同一把锁内完成，避免并发请求重复使用一次性的验证
+	pathedSession.mutex.Lock()
+	defer pathedSession.mutex.Unlock()
 	if pathedSession.captchaAllowedTimes <= 0 {
 		return pathedSession.id, pathedSession.captchaExpiredAt.After(time.Now()), false
 	}
@@ -120,12 +194,25 @@ func (f *FastGoCaptcha) NoNeedCaptcha(r *http.Request) (sessionId string, noNeed
 	return pathedSession.id, true, true
 }
 
+// isVerified 与 NoNeedCaptcha 相同，但不会消耗一次性的验证次数
+func (f *FastGoCaptcha) isVerified(r *http.Request) bool {
+	pathedSession, err := f.GetCaptchaSession(r)
+	if err != nil || !f.fingerprintMatches(pathedSession, r) {
+		return false
+	}
+	pathedSession.mutex.Lock()
+	defer pathedSession.mutex.Unlock()
+	return pathedSession.captchaAllowedTimes > 0 || pathedSession.captchaExpiredAt.After(time.Now())
+}
+
 func (f *FastGoCaptcha) UpdateSessionCaptchaID(r *http.Request, captchaID string) error {
 	pathedSession, err := f.GetCaptchaSession(r)
 	if err != nil {
 		return err
 	}
+	pathedSession.mutex.Lock()
 	pathedSession.captchaID = captchaID
+	pathedSession.mutex.Unlock()
 	return nil
 }
 
@@ -134,8 +221,11 @@ func (f *FastGoCaptcha) UpdateSessionCaptchaExpiresAt(r *http.Request, timeout t
 	if err != nil {
 		return err
 	}
-	pathedSession.captchaExpiredAt = time.Now().Add(timeout)
-	f.logInfof("UpdateSessionCaptchaExpiresAt: %s, %v", pathedSession.id, pathedSession.captchaExpiredAt)
+	expiresAt := time.Now().Add(timeout)
+	pathedSession.mutex.Lock()
+	pathedSession.captchaExpiredAt = expiresAt
+	pathedSession.mutex.Unlock()
+	f.logDebug("update session verification expiry", "session_id", f.hashSessionID(pathedSession.id), "path", pathedSession.path, "expires_at", expiresAt)
 	return nil
 }
 
@@ -144,11 +234,31 @@ func (f *FastGoCaptcha) UpdateSessionCaptchaTimes(r *http.Request, times int) er
 	if err != nil {
 		return err
 	}
+	pathedSession.mutex.Lock()
 	pathedSession.captchaAllowedTimes = times
+	pathedSession.mutex.Unlock()
 	return nil
 }
 
 func (f *FastGoCaptcha) CreateSessionWithCaptchaIDAndRedirect(w http.ResponseWriter, r *http.Request, captchaID string) error {
+	session, err := f.createSessionWithCaptchaID(w, r, captchaID)
+	if err != nil {
+		return err
+	}
+	// 只有跳转到验证码页面的请求需要保存，JSON 挑战由客户端自己在验证后重试
+	f.stashRequest(r, session)
+	f.emitEvent(r, &Event{Type: EventChallengeIssued, SessionID: session.id, CaptchaID: captchaID, Challenge: ChallengeTypePage})
+	if isSafeMethod(r.Method) {
+		http.Redirect(w, r, r.URL.String(), http.StatusFound)
+	} else {
+		// 非幂等请求的 body 已经被保存，明确要求浏览器用 GET 重新访问
+		http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+	}
+	return nil
+}
+
+// createSessionWithCaptchaID 把验证码 ID 绑定到当前会话并写入 cookie
+func (f *FastGoCaptcha) createSessionWithCaptchaID(w http.ResponseWriter, r *http.Request, captchaID string) (*PathedSession, error) {
 	// 如果sessionManager未初始化，则初始化它
 	if f.sessionManager == nil {
 		f.sessionManager = &sync.Map{}
@@ -157,55 +267,63 @@ func (f *FastGoCaptcha) CreateSessionWithCaptchaIDAndRedirect(w http.ResponseWri
 	session := f.GetOrCreateSession(r)
 	newPath, err := f.GetCaptchaRequiredPath(r)
 	if err != nil {
-		f.logErrorf("GetCaptchaRequiredPath error: %v", err)
-		return err
+		f.logError("failed to get captcha path", "path", r.URL.Path, "error", err)
+		return nil, err
 	}
 
+	key := f.scopeKey(newPath)
 	var pathedSession *PathedSession
-	pathedSessionRaw, ok := session.pathed.Load(newPath)
+	pathedSessionRaw, ok := session.pathed.Load(key)
 	if !ok {
-		f.logInfof("CreateSessionWithCaptchaIDAndRedirect: newPath not found, create new pathedSession")
+		f.logDebug("create pathed session", "session_id", f.hashSessionID(session.id), "captcha_id", captchaID, "path", newPath)
 		pathedSession = &PathedSession{
 			id:        session.id,
 			path:      newPath,
 			captchaID: captchaID,
 		}
-		session.pathed.Store(newPath, pathedSession)
+		session.pathed.Store(key, pathedSession)
 	} else {
-		f.logInfof("CreateSessionWithCaptchaIDAndRedirect: newPath found, update pathedSession")
-		pathedSession, ok := pathedSessionRaw.(*PathedSession)
+		f.logDebug("update pathed session", "session_id", f.hashSessionID(session.id), "captcha_id", captchaID, "path", newPath)
+		pathedSession, ok = pathedSessionRaw.(*PathedSession)
 		if !ok {
-			return errors.New("captcha is not required")
+			return nil, errors.New("captcha is not required")
 		}
+		pathedSession.mutex.Lock()
 		pathedSession.captchaID = captchaID
+		pathedSession.mutex.Unlock()
 	}
+	f.bindCaptchaToSession(captchaID, session.id)
 
-	cookie, err := r.Cookie("fastgocaptcha_session")
-	if err != nil {
-		f.logInfof("CreateSessionWithCaptchaIDAndRedirect: session is not found, create new session")
-		cookie = &http.Cookie{
-			Name:     "fastgocaptcha_session",
-			Value:    session.id,
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   int(f.sessionTimeout.Seconds()),
-			SameSite: http.SameSiteNoneMode,
-			Secure:   true,
-		}
+	session.touch(f.sessionTimeout)
+	f.setSessionCookie(w, r, session.id)
+	return pathedSession, nil
+}
+
+// bindCaptchaToSession 记录验证码由哪个会话签发，校验时拒绝其他会话提交
+func (f *FastGoCaptcha) bindCaptchaToSession(captchaID string, sessionID string) {
+	data, ok := f.loadGoCaptchaData(captchaID)
+	if !ok || data == nil {
+		return
 	}
-	oldId := cookie.Value
-	if oldId != session.id {
-		cookie = &http.Cookie{
-			Name:     "fastgocaptcha_session",
-			Value:    session.id,
-			Path:     "/",
-			HttpOnly: true,
-			MaxAge:   int(f.sessionTimeout.Seconds()),
-			SameSite: http.SameSiteNoneMode,
-			Secure:   true,
-		}
+	if data.sessionID == sessionID {
+		return
 	}
-	http.SetCookie(w, cookie)
-	http.Redirect(w, r, r.URL.String(), http.StatusFound)
-	return nil
+	bound := *data
+	bound.sessionID = sessionID
+	f.storeGoCaptchaData(captchaID, &bound)
+}
+
+// captchaOwnedBy 检查验证码是否由当前请求的会话签发，未绑定会话的验证码任何人都可以提交
+func (f *FastGoCaptcha) captchaOwnedBy(data *SlideBlockWrapper, r *http.Request) bool {
+	if data.sessionID == "" {
+		return true
+	}
+	sessionID, ok := f.sessionCookieValue(r)
+	return ok && sessionID == data.sessionID
+}
+
+// isSessionCaptcha 检查验证码是否是当前会话在该路径上等待的验证码
+func (f *FastGoCaptcha) isSessionCaptcha(r *http.Request, captchaID string) bool {
+	sessionCaptchaID, err := f.GetCaptchaIDFromSession(r)
+	return err == nil && sessionCaptchaID == captchaID
 }
@@ -0,0 +1,144 @@
+package fastgocaptcha
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultReplayMaxBodySize int64 = 1 << 20
+	defaultReplayTimeout           = 5 * time.Minute
+)
+
+// stashedRequest 保存被验证码拦截的非 GET 请求，验证成功后再次访问同一路径时重放
+type stashedRequest struct {
+	method      string
+	path        string
+	rawQuery    string
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// WithRequestReplay 设置被拦截请求的最大 body 大小和保存时间，maxBodySize < 0 表示关闭重放
+func WithRequestReplay(maxBodySize int64, timeout time.Duration) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.replayMaxBodySize = maxBodySize
+		f.replayTimeout = timeout
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// isSameOriginRequest 跨站请求不会被保存，避免验证成功后替攻击者重放请求
+func isSameOriginRequest(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		return origin == ""
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// isNavigationRequest 判断请求是否为页面导航，不支持 Sec-Fetch-Mode 的浏览器视为导航
+func isNavigationRequest(r *http.Request) bool {
+	mode := r.Header.Get("Sec-Fetch-Mode")
+	return mode == "" || mode == "navigate"
+}
+
+// stashRequest 在返回验证码挑战前保存原始请求
+func (f *FastGoCaptcha) stashRequest(r *http.Request, pathedSession *PathedSession) {
+	if f.replayMaxBodySize < 0 || pathedSession == nil || isSafeMethod(r.Method) {
+		return
+	}
+	if !isSameOriginRequest(r) {
+		f.logWarning("cross-site request is not stashed for replay", "method", r.Method, "path", r.URL.Path)
+		return
+	}
+	if r.ContentLength > f.replayMaxBodySize {
+		f.logWarning("request body is too large to stash", "method", r.Method, "path", r.URL.Path, "size", r.ContentLength)
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, f.replayMaxBodySize+1))
+		if err != nil {
+			f.logWarning("failed to read request body for replay", "method", r.Method, "path", r.URL.Path, "error", err)
+			return
+		}
+		if int64(len(body)) > f.replayMaxBodySize {
+			f.logWarning("request body is too large to stash", "method", r.Method, "path", r.URL.Path)
+			return
+		}
+	}
+
+	pathedSession.mutex.Lock()
+	defer pathedSession.mutex.Unlock()
+	pathedSession.stashed = &stashedRequest{
+		method:      r.Method,
+		path:        r.URL.Path,
+		rawQuery:    r.URL.RawQuery,
+		contentType: r.Header.Get("Content-Type"),
+		body:        body,
+		expiresAt:   time.Now().Add(f.replayTimeout),
+	}
+	f.logDebug("stashed request for replay", "method", r.Method, "path", r.URL.Path, "session_id", f.hashSessionID(pathedSession.id), "size", len(body))
+}
+
+// restoreStashedRequest 如果会话中保存了同一路径的原始请求，则返回重建后的请求，保存的请求只会被使用一次
+func (f *FastGoCaptcha) restoreStashedRequest(r *http.Request) *http.Request {
+	if f.replayMaxBodySize < 0 || r.Method != http.MethodGet {
+		return r
+	}
+	// 只有验证成功后同源的页面跳转才能触发重放，跨站的 <img>、链接等 GET 请求不会消耗保存的请求
+	if !isSameOriginRequest(r) || !isNavigationRequest(r) {
+		return r
+	}
+	pathedSession, err := f.GetCaptchaSession(r)
+	if err != nil {
+		return r
+	}
+
+	pathedSession.mutex.Lock()
+	stashed := pathedSession.stashed
+	if stashed == nil || stashed.path != r.URL.Path {
+		pathedSession.mutex.Unlock()
+		return r
+	}
+	pathedSession.stashed = nil
+	pathedSession.mutex.Unlock()
+
+	if time.Now().After(stashed.expiresAt) {
+		f.logDebug("stashed request expired, skip replay", "method", stashed.method, "path", stashed.path)
+		return r
+	}
+
+	replayed := r.Clone(r.Context())
+	replayed.Method = stashed.method
+	replayed.URL.RawQuery = stashed.rawQuery
+	replayed.RequestURI = replayed.URL.RequestURI()
+	replayed.Body = io.NopCloser(bytes.NewReader(stashed.body))
+	replayed.ContentLength = int64(len(stashed.body))
+	replayed.Header.Set("Content-Length", strconv.Itoa(len(stashed.body)))
+	if stashed.contentType != "" {
+		replayed.Header.Set("Content-Type", stashed.contentType)
+	} else {
+		replayed.Header.Del("Content-Type")
+	}
+	f.logDebug("replay stashed request", "method", stashed.method, "path", stashed.path, "session_id", f.hashSessionID(pathedSession.id))
+	return replayed
+}
@@ -0,0 +1,75 @@
+// FastGoCaptcha 挑战页面脚本，配置来自 #fastgocaptcha-challenge 的 data 属性，文案来自 fastgocaptcha.i18n.js
+(function() {
+    const root = document.getElementById('fastgocaptcha-challenge');
+    const messages = window.FastGoCaptchaMessages || {};
+    const successMessage = document.querySelector('.success-message');
+    const errorMessage = document.querySelector('.error-message');
+
+    function text(key, fallback) {
+        return messages[key] || fallback;
+    }
+
+    showSlideCaptcha({
+        captchaUrl: root.dataset.captchaUrl,
+        verifyUrl: root.dataset.verifyUrl,
+        onSuccess: function(captchaId, result) {
+            successMessage.classList.add('visible');
+            window.parent.postMessage({ status: "success" }, "*");
+            window.onload = () => {
+                window.parent.postMessage({ status: "success" }, "*");
+            }
+            // 验证成功后回到原始页面，优先使用校验接口返回的 return_to
+            const returnUrl = (result && result.return_to) || root.dataset.returnUrl;
+            if (returnUrl) {
+                setTimeout(function() {
+                    window.location.assign(returnUrl);
+                }, 1000);
+            }
+        },
+        onError: function(error) {
+            errorMessage.classList.add('visible');
+            window.parent.postMessage({ status: "error" }, "*");
+            window.onload = () => {
+                window.parent.postMessage({ status: "error" }, "*");
+            }
+
+            // 创建锁定遮罩层
+            const overlay = document.createElement('div');
+            overlay.id = 'captcha-lock-overlay';
+            overlay.className = 'captcha-lock-overlay';
+
+            // 创建错误提示 toast
+            const reloading = text('page_reloading', 'Verification failed. Please try again. Reloading in {seconds} seconds...');
+            let countdown = 1.5;
+            const toast = document.createElement('div');
+            toast.className = 'captcha-error-toast';
+            toast.textContent = reloading.replace('{seconds}', countdown);
+
+            overlay.appendChild(toast);
+            document.body.appendChild(overlay);
+
+            // 设置倒计时
+            const countdownInterval = setInterval(function() {
+                countdown -= 0.5;
+                toast.textContent = reloading.replace('{seconds}', countdown);
+
+                if (countdown <= 0) {
+                    clearInterval(countdownInterval);
+                    document.body.removeChild(overlay);
+                    errorMessage.classList.remove('visible');
+                    // 刷新验证码
+                    window.location.reload();
+                }
+            }, 500);
+        },
+        onClose: function() {
+            const toast = document.createElement('div');
+            toast.className = 'captcha-cancel-toast';
+            toast.textContent = text('page_cancelled', 'Verification cancelled');
+            document.body.appendChild(toast);
+            setTimeout(function() {
+                document.body.removeChild(toast);
+            }, 3000);
+        }
+    });
+})();
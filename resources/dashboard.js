@@ -0,0 +1,147 @@
+// FastGoCaptcha 管理面板脚本，数据来自同一挂载路径下的 stats 接口。
+// 路径、IP 等内容来自客户端请求，只能通过 textContent 写入页面
+(function() {
+    const refreshInterval = 5000;
+    const tokenKey = 'fastgocaptcha-admin-token';
+    const status = document.getElementById('status');
+    const login = document.getElementById('login');
+    const dashboard = document.getElementById('dashboard');
+    let timer = null;
+
+    function setText(id, value) {
+        document.getElementById(id).textContent = value;
+    }
+
+    function setStatus(message, isError) {
+        status.textContent = message;
+        status.classList.toggle('error', !!isError);
+    }
+
+    function renderRows(id, rows) {
+        const body = document.getElementById(id);
+        body.replaceChildren();
+        if (rows.length === 0) {
+            const tr = document.createElement('tr');
+            const td = document.createElement('td');
+            td.className = 'empty';
+            td.textContent = 'none';
+            tr.appendChild(td);
+            body.appendChild(tr);
+            return;
+        }
+        rows.forEach(function(row) {
+            const tr = document.createElement('tr');
+            const key = document.createElement('td');
+            key.textContent = row[0];
+            const value = document.createElement('td');
+            value.className = 'count';
+            value.textContent = row[1];
+            tr.appendChild(key);
+            tr.appendChild(value);
+            body.appendChild(tr);
+        });
+    }
+
+    function counts(list) {
+        return (list || []).map(function(item) {
+            return [item.key, item.count];
+        });
+    }
+
+    function renderTimeline(points) {
+        const timeline = document.getElementById('timeline');
+        const max = Math.max(1, ...points.map(function(p) {
+            return Math.max(p.challenges, p.successes, p.failures);
+        }));
+        timeline.replaceChildren();
+        points.forEach(function(p) {
+            const minute = document.createElement('div');
+            minute.className = 'minute';
+            minute.title = new Date(p.time).toLocaleTimeString() + ': ' +
+                p.challenges + ' challenges, ' + p.successes + ' solved, ' + p.failures + ' failed';
+            ['challenges', 'successes', 'failures'].forEach(function(kind) {
+                const bar = document.createElement('div');
+                bar.className = 'bar ' + kind;
+                bar.style.height = (p[kind] / max * 100) + '%';
+                minute.appendChild(bar);
+            });
+            timeline.appendChild(minute);
+        });
+    }
+
+    function render(stats) {
+        setText('challenges', stats.challenges);
+        setText('solve-rate', stats.successes + stats.failures > 0 ? (stats.solve_rate * 100).toFixed(1) + '%' : '-');
+        setText('successes', stats.successes);
+        setText('failures', stats.failures);
+        setText('solve-time', stats.successes > 0 ? stats.avg_solve_seconds.toFixed(1) + 's' : '-');
+        setText('bypasses', stats.bypasses);
+        setText('rate-limited', stats.rate_limited);
+        setText('banned', stats.banned);
+        renderTimeline(stats.timeline || []);
+        renderRows('failure-reasons', counts(stats.failure_reasons));
+        renderRows('top-paths', counts(stats.top_paths));
+        renderRows('top-failing-ips', counts(stats.top_failing_ips));
+
+        const pool = stats.pool || {};
+        renderRows('pool', [
+            ['Active sessions', pool.active_sessions],
+            ['Outstanding captchas', pool.outstanding_captchas == null ? 'custom store' : pool.outstanding_captchas],
+            ['Generated', pool.generated],
+            ['Generation errors', pool.generation_errors],
+            ['Avg generation time', pool.generated > 0 ? pool.generation_avg_ms.toFixed(1) + 'ms' : '-'],
+            ['Active bans', stats.active_bans],
+        ]);
+        setStatus('last ' + stats.window + ', updated ' + new Date(stats.time).toLocaleTimeString());
+    }
+
+    function showLogin() {
+        clearTimeout(timer);
+        dashboard.classList.add('hidden');
+        login.classList.remove('hidden');
+        setStatus('authentication required', true);
+    }
+
+    function refresh() {
+        clearTimeout(timer);
+        const headers = { 'Accept': 'application/json' };
+        const token = sessionStorage.getItem(tokenKey);
+        if (token) {
+            headers['Authorization'] = 'Bearer ' + token;
+        }
+        fetch('stats', { headers: headers, cache: 'no-store', credentials: 'same-origin' })
+            .then(function(response) {
+                if (response.status === 401) {
+                    sessionStorage.removeItem(tokenKey);
+                    showLogin();
+                    return null;
+                }
+                if (!response.ok) {
+                    throw new Error('HTTP ' + response.status);
+                }
+                return response.json();
+            })
+            .then(function(stats) {
+                if (!stats) {
+                    return;
+                }
+                login.classList.add('hidden');
+                dashboard.classList.remove('hidden');
+                render(stats);
+                timer = setTimeout(refresh, refreshInterval);
+            })
+            .catch(function(error) {
+                setStatus('refresh failed: ' + error.message, true);
+                timer = setTimeout(refresh, refreshInterval);
+            });
+    }
+
+    login.addEventListener('submit', function(event) {
+        event.preventDefault();
+        sessionStorage.setItem(tokenKey, document.getElementById('token').value);
+        document.getElementById('token').value = '';
+        refresh();
+    });
+
+    refresh();
+})();
@@ -1,11 +1,16 @@
+// 记录加载本脚本时使用的 CSP nonce，动态加载依赖时沿用
+const fastgocaptchaNonce = (document.currentScript && document.currentScript.nonce) || '';
+
 /**
  * 显示滑动验证码弹窗
  * @param {Object} options - 配置选项
  * @param {string} options.captchaUrl - 获取验证码的URL，默认为'/fastgocaptcha/captcha'
  * @param {string} options.verifyUrl - 验证的URL，默认为'/fastgocaptcha/verify'
- * @param {Function} options.onSuccess - 验证成功的回调函数
+ * @param {Function} options.onSuccess - 验证成功的回调函数，参数为 captchaId 和校验接口的响应
  * @param {Function} options.onError - 验证失败的回调函数
  * @param {Function} options.onClose - 弹窗关闭的回调函数
+ * @param {string} options.credentials - 请求验证码接口时的 fetch credentials，跨域时使用 'include' 携带会话 cookie，默认为 'same-origin'
+ * @param {Object} options.messages - 覆盖界面文案，默认使用 window.FastGoCaptchaMessages（由 fastgocaptcha.i18n.js 提供）
  * @returns {Object} 包含close方法的对象，用于手动关闭弹窗
  */
 function showSlideCaptcha(options = {}) {
@@ -13,6 +18,7 @@ function showSlideCaptcha(options = {}) {
     const defaults = {
         captchaUrl: '/fastgocaptcha/captcha',
         verifyUrl: '/fastgocaptcha/verify',
+        credentials: 'same-origin',
         onSuccess: () => {},
         onError: () => {},
         onClose: () => {}
@@ -20,22 +26,56 @@ function showSlideCaptcha(options = {}) {
     
     // 合并选项
     const settings = {...defaults, ...options};
+
+    // 文案：内置中文 < fastgocaptcha.i18n.js < options.messages
+    const messages = {
+        title: '请完成滑动验证',
+        loading: '加载中...',
+        slide: '请拖动滑块完成拼图',
+        success: '验证成功',
+        error: '验证失败',
+        refresh: '刷新验证码',
+        load_failed: '验证码加载失败，请刷新重试',
+        verify_failed: '验证失败，请重试',
+        request_failed: '验证请求失败，请重试',
+        component_error: '加载验证组件失败',
+        ...(window.FastGoCaptchaMessages || {}),
+        ...(options.messages || {})
+    };
     
-    // 确保依赖的CSS和JS已加载
-    function ensureDependenciesLoaded() {
-        return new Promise((resolve, reject) => {
-            // 检查CSS是否已加载
-            if (!document.querySelector('link[href="/fastgocaptcha/resources/gocaptcha.global.css"]')) {
-                const cssLink = document.createElement('link');
-                cssLink.rel = 'stylesheet';
-                cssLink.href = '/fastgocaptcha/resources/gocaptcha.global.css';
-                document.head.appendChild(cssLink);
+    // 确保依赖的CSS和JS已加载，样式全部来自外部 CSS 文件，兼容不允许 unsafe-inline 的 CSP
+    function ensureStylesheet(href) {
+        return new Promise((resolve) => {
+            if (document.querySelector('link[href="' + href + '"]')) {
+                resolve();
+                return;
             }
-            
+            const cssLink = document.createElement('link');
+            cssLink.rel = 'stylesheet';
+            cssLink.href = href;
+            if (fastgocaptchaNonce) {
+                cssLink.nonce = fastgocaptchaNonce;
+            }
+            cssLink.onload = resolve;
+            // 样式加载失败不影响验证码的使用
+            cssLink.onerror = resolve;
+            document.head.appendChild(cssLink);
+        });
+    }
+
+    function ensureDependenciesLoaded() {
+        const styles = Promise.all([
+            ensureStylesheet('/fastgocaptcha/resources/gocaptcha.global.css'),
+            ensureStylesheet('/fastgocaptcha/resources/fastgocaptcha.css')
+        ]);
+        const script = new Promise((resolve, reject) => {
             // 检查JS是否已加载
             if (typeof GoCaptcha === 'undefined') {
                 const jsScript = document.createElement('script');
                 jsScript.src = '/fastgocaptcha/resources/gocaptcha.global.js';
+                if (fastgocaptchaNonce) {
+                    jsScript.nonce = fastgocaptchaNonce;
+                }
                 jsScript.onload = resolve;
                 jsScript.onerror = reject;
                 document.head.appendChild(jsScript);
@@ -43,6 +83,7 @@ function showSlideCaptcha(options = {}) {
                 resolve();
             }
         });
+        return Promise.all([styles, script]);
     }
     
     // 创建模态框
@@ -50,56 +91,21 @@ function showSlideCaptcha(options = {}) {
         // 创建模态框容器
         const modal = document.createElement('div');
         modal.className = 'slide-captcha-modal';
-        modal.style.cssText = `
-            position: fixed;
-            top: 0;
-            left: 0;
-            width: 100%;
-            height: 100%;
-            background-color: rgba(0, 0, 0, 0.5);
-            display: flex;
-            justify-content: center;
-            align-items: center;
-            z-index: 9999;
-        `;
         
         // 创建模态框内容
         const modalContent = document.createElement('div');
         modalContent.className = 'slide-captcha-modal-content';
-        modalContent.style.cssText = `
-            background-color: white;
-            padding: 30px;
-            border-radius: 10px;
-            box-shadow: 0 4px 10px rgba(0, 0, 0, 0.1);
-            width: 320px;
-            position: relative;
-        `;
         
         // 创建关闭按钮
         const closeButton = document.createElement('button');
         closeButton.className = 'slide-captcha-close-btn';
         closeButton.innerHTML = '&times;';
-        closeButton.style.cssText = `
-            position: absolute;
-            top: 10px;
-            right: 10px;
-            background: none;
-            border: none;
-            font-size: 24px;
-            cursor: pointer;
-            color: #999;
-        `;
         closeButton.onclick = closeModal;
         
         // 创建标题
         const title = document.createElement('h2');
-        title.textContent = '请完成滑动验证';
-        title.style.cssText = `
-            text-align: center;
-            color: #333;
-            margin-bottom: 20px;
-            font-size: 18px;
-        `;
+        title.className = 'slide-captcha-title';
+        title.textContent = settings.title || messages.title;
         
         // 创建验证码容器
         const captchaContainer = document.createElement('div');
@@ -130,26 +136,28 @@ function showSlideCaptcha(options = {}) {
     // 初始化验证码
     function initCaptcha(container) {
         let captchaId = '';
+        let csrfToken = '';
         
-        // 创建验证码实例
-        const capt = new GoCaptcha.Slide({
+        // 创建验证码实例，尺寸以验证码接口返回的图片尺寸为准
+        const config = {
             width: 300,
             height: 220,
             text: {
-                loading: '加载中...',
-                slide: '请拖动滑块完成拼图',
-                success: '验证成功',
-                error: '验证失败',
-                refresh: '刷新验证码'
+                loading: messages.loading,
+                slide: messages.slide,
+                success: messages.success,
+                error: messages.error,
+                refresh: messages.refresh
             }
-        });
+        };
+        const capt = new GoCaptcha.Slide(config);
         
         // 挂载到容器
         capt.mount(container);
         
         // 加载验证码
         function loadCaptcha() {
-            fetch(settings.captchaUrl)
+            fetch(settings.captchaUrl, {credentials: settings.credentials})
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('Network response was not ok');
@@ -161,6 +169,15 @@ function showSlideCaptcha(options = {}) {
                         throw new Error('Invalid captcha data received');
                     }
                     captchaId = data.fastgocaptcha_id;
+                    csrfToken = data.fastgocaptcha_csrf_token || '';
+
+                    const width = data.fastgocaptcha_image_width;
+                    const height = data.fastgocaptcha_image_height;
+                    if (width && height && (width !== config.width || height !== config.height)) {
+                        config.width = width;
+                        config.height = height;
+                        capt.setConfig(config);
+                    }
                     
                     // 设置验证码数据
                     capt.setData({
@@ -174,7 +191,7 @@ function showSlideCaptcha(options = {}) {
                 })
                 .catch(err => {
                     console.error('Failed to load captcha:', err);
-                    settings.onError('验证码加载失败，请刷新重试');
+                    settings.onError(messages.load_failed);
                 });
         }
         
@@ -184,18 +201,22 @@ function showSlideCaptcha(options = {}) {
                 const formData = new FormData();
                 formData.append('id', captchaId);
                 formData.append('x', point.x);
+                if (csrfToken) {
+                    formData.append('csrf_token', csrfToken);
+                }
                 
                 fetch(settings.verifyUrl, {
                     method: 'POST',
-                    body: formData
+                    body: formData,
+                    credentials: settings.credentials
                 })
                 .then(response => response.json())
                 .then(data => {
                     if (data.success) {
-                        settings.onSuccess(captchaId);
+                        settings.onSuccess(captchaId, data);
                         setTimeout(closeModal, 1000); // 验证成功后延迟关闭
                     } else {
-                        settings.onError('验证失败，请重试');
+                        settings.onError(messages.verify_failed);
                         reset();
                         // 重新加载验证码
                         setTimeout(loadCaptcha, 1000);
@@ -203,7 +224,7 @@ function showSlideCaptcha(options = {}) {
                 })
                 .catch(err => {
                     console.error('Verification failed:', err);
-                    settings.onError('验证请求失败，请重试');
+                    settings.onError(messages.request_failed);
                     reset();
                 });
             },
@@ -228,7 +249,7 @@ function showSlideCaptcha(options = {}) {
         captcha = initCaptcha(elements.captchaContainer);
     }).catch(error => {
         console.error('Failed to load dependencies:', error);
-        settings.onError('加载验证组件失败');
+        settings.onError(messages.component_error);
     });
     
     // 返回控制对象
@@ -236,3 +257,59 @@ function showSlideCaptcha(options = {}) {
         close: closeModal
     };
 }
+
+/**
+ * 发送请求，遇到 FastGoCaptcha 的 JSON 挑战时自动弹出滑动验证码，验证成功后重试原请求
+ * @param {RequestInfo} input - 同 fetch 的第一个参数
+ * @param {RequestInit} init - 同 fetch 的第二个参数，body 需要可以重复发送
+ * @param {Object} options - 传递给 showSlideCaptcha 的额外选项
+ * @returns {Promise<Response>} 最终的响应
+ */
+function fetchWithCaptcha(input, init = {}, options = {}) {
+    const headers = new Headers(init.headers || {});
+    if (!headers.has('Accept')) {
+        headers.set('Accept', 'application/json');
+    }
+    if (!headers.has('X-Requested-With')) {
+        headers.set('X-Requested-With', 'XMLHttpRequest');
+    }
+    const request = {...init, headers};
+
+    return fetch(input, request).then(response => {
+        const contentType = response.headers.get('Content-Type') || '';
+        if ([401, 403, 428].indexOf(response.status) === -1 || contentType.indexOf('application/json') === -1) {
+            return response;
+        }
+        return response.clone().json().then(challenge => {
+            if (challenge.code !== 'captcha_required') {
+                return response;
+            }
+            // 挑战中的地址相对于 API 所在的源，跨域调用时需要按响应地址解析
+            const absoluteURL = url => new URL(url, response.url || window.location.href).toString();
+            return new Promise((resolve, reject) => {
+                let verified = false;
+                showSlideCaptcha({
+                    credentials: request.credentials,
+                    ...options,
+                    captchaUrl: absoluteURL(challenge.captcha_url),
+                    verifyUrl: absoluteURL(challenge.verify_url),
+                    onSuccess: (id, result) => {
+                        verified = true;
+                        if (options.onSuccess) {
+                            options.onSuccess(id, result);
+                        }
+                        fetch(input, request).then(resolve, reject);
+                    },
+                    onClose: () => {
+                        if (options.onClose) {
+                            options.onClose();
+                        }
+                        if (!verified) {
+                            reject(new Error('captcha verification cancelled'));
+                        }
+                    }
+                });
+            });
+        }, () => response);
+    });
+}
@@ -0,0 +1,160 @@
+package fastgocaptcha
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultReturnToTimeout = time.Hour
+
+// WithReturnToSecret 设置 return_to 签名使用的密钥，多实例部署时需要保持一致，默认每个实例随机生成
+func WithReturnToSecret(secret []byte) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.returnToSecret = secret
+	}
+}
+
+// WithReturnToHosts 允许 return_to 跳转到这些主机的绝对地址，默认只允许站内相对路径
+func WithReturnToHosts(hosts ...string) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		for _, host := range hosts {
+			f.returnToHosts = append(f.returnToHosts, strings.ToLower(strings.TrimSpace(host)))
+		}
+	}
+}
+
+func (f *FastGoCaptcha) initReturnTo() error {
+	if len(f.returnToSecret) == 0 {
+		f.returnToSecret = make([]byte, 32)
+		if _, err := rand.Read(f.returnToSecret); err != nil {
+			return fmt.Errorf("failed to generate return_to secret: %v", err)
+		}
+	}
+	return nil
+}
+
+// safeReturnPath 只接受站内相对路径，防止开放重定向
+func safeReturnPath(raw string) (string, bool) {
+	if raw == "" || !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") || strings.ContainsAny(raw, "\\\r\n") {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+	return u.RequestURI(), true
+}
+
+// validateReturnTo 检查跳转地址是站内相对路径，或者是允许的主机上的 http(s) 地址
+func (f *FastGoCaptcha) validateReturnTo(raw string) (string, error) {
+	if path, ok := safeReturnPath(raw); ok {
+		return path, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || strings.ContainsAny(raw, "\\\r\n") {
+		return "", fmt.Errorf("invalid return_to: %q", raw)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return "", fmt.Errorf("return_to must be a relative path or an allowed http(s) url: %q", raw)
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range f.returnToHosts {
+		if host == allowed || strings.ToLower(u.Host) == allowed {
+			return u.String(), nil
+		}
+	}
+	return "", fmt.Errorf("return_to host is not allowed: %s", u.Host)
+}
+
+func (f *FastGoCaptcha) returnToMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, f.returnToSecret)
+	mac.Write([]byte("fastgocaptcha-return-to:" + payload))
+	return mac.Sum(nil)
+}
+
+// SignReturnTo 校验并签名跳转地址，返回可以放进 return_to 参数的令牌，令牌一小时内有效
+func (f *FastGoCaptcha) SignReturnTo(rawURL string) (string, error) {
+	target, err := f.validateReturnTo(rawURL)
+	if err != nil {
+		return "", err
+	}
+	payload := strconv.FormatInt(time.Now().Add(defaultReturnToTimeout).Unix(), 10) + "|" + target
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(f.returnToMAC(payload)), nil
+}
+
+// VerifyReturnTo 校验 return_to 令牌的签名和有效期，并再次检查跳转地址，返回原始地址
+func (f *FastGoCaptcha) VerifyReturnTo(token string) (string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errors.New("malformed return_to")
+	}
+	payloadRaw, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", errors.New("malformed return_to")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", errors.New("malformed return_to")
+	}
+	payload := string(payloadRaw)
+	if !hmac.Equal(mac, f.returnToMAC(payload)) {
+		return "", errors.New("return_to signature mismatch")
+	}
+	rawExpires, target, ok := strings.Cut(payload, "|")
+	if !ok {
+		return "", errors.New("malformed return_to")
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return "", errors.New("malformed return_to")
+	}
+	if time.Now().Unix() > expires {
+		return "", errors.New("return_to expired")
+	}
+	return f.validateReturnTo(target)
+}
+
+// returnToFromQuery 读取并校验请求中的 return_to，无效时返回空字符串
+func (f *FastGoCaptcha) returnToFromQuery(values url.Values) (token string, target string) {
+	token = values.Get("return_to")
+	if token == "" {
+		return "", ""
+	}
+	target, err := f.VerifyReturnTo(token)
+	if err != nil {
+		f.logWarning("ignore invalid return_to", "error", err)
+		return "", ""
+	}
+	return token, target
+}
+
+// challengeURL 返回带有签名 return_to 的挑战页面地址
+func (f *FastGoCaptcha) challengeURL(endpoint string, path string, returnTo string) string {
+	u := f.endpointURL(endpoint, path)
+	if returnTo == "" {
+		return u
+	}
+	token, err := f.SignReturnTo(returnTo)
+	if err != nil {
+		f.logWarning("failed to sign return_to", "return_to", returnTo, "error", err)
+		return u
+	}
+	return appendQuery(u, "return_to", token)
+}
+
+func appendQuery(u string, key string, value string) string {
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	return u + sep + key + "=" + url.QueryEscape(value)
+}
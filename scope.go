@@ -0,0 +1,91 @@
+package fastgocaptcha
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProtectScope 决定一次验证成功后可以解锁哪些请求
+type ProtectScope string
+
+const (
+	// ScopePath 每个具体路径单独验证（默认行为）
+	ScopePath ProtectScope = "path"
+	// ScopeMatcher 同一条保护规则命中的所有路径共享一次验证
+	ScopeMatcher ProtectScope = "matcher"
+	// ScopeGroup 同名分组中的所有保护规则共享一次验证
+	ScopeGroup ProtectScope = "group"
+	// ScopeSite 整个站点共享一次验证
+	ScopeSite ProtectScope = "site"
+)
+
+func ParseProtectScope(raw string) (ProtectScope, error) {
+	switch scope := ProtectScope(strings.ToLower(strings.TrimSpace(raw))); scope {
+	case "":
+		return "", nil
+	case ScopePath, ScopeMatcher, ScopeGroup, ScopeSite:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown protect scope: %s", raw)
+	}
+}
+
+type ProtectMatcherOption func(*FastGoCaptchaMatcher)
+
+func WithMatcherScope(scope ProtectScope) ProtectMatcherOption {
+	return func(m *FastGoCaptchaMatcher) {
+		m.scope = scope
+	}
+}
+
+// WithMatcherGroup 把规则加入分组，分组内任意规则验证成功后整个分组都会被解锁
+func WithMatcherGroup(group string) ProtectMatcherOption {
+	return func(m *FastGoCaptchaMatcher) {
+		m.scope = ScopeGroup
+		m.group = group
+	}
+}
+
+func WithDefaultProtectScope(scope ProtectScope) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.defaultScope = scope
+	}
+}
+
+func (m *FastGoCaptchaMatcher) validateScope() error {
+	if _, err := ParseProtectScope(string(m.scope)); err != nil {
+		return err
+	}
+	if m.scope == ScopeGroup && strings.TrimSpace(m.group) == "" {
+		return fmt.Errorf("group scope requires a group name")
+	}
+	return nil
+}
+
+func (f *FastGoCaptcha) matcherScope(m *FastGoCaptchaMatcher) ProtectScope {
+	if m.scope != "" {
+		return m.scope
+	}
+	if f.defaultScope != "" {
+		return f.defaultScope
+	}
+	return ScopePath
+}
+
+// scopeKey 返回会话中保存验证状态使用的 key，未命中保护规则时使用路径本身
+func (f *FastGoCaptcha) scopeKey(path string) string {
+	protected, matcher := f.CheckProtectMatcher(path)
+	if !protected {
+		return path
+	}
+	switch f.matcherScope(matcher) {
+	case ScopeMatcher:
+		return "matcher:" + matcher.rawRoute
+	case ScopeGroup:
+		return "group:" + matcher.group
+	case ScopeSite:
+		return "site:"
+	default:
+		return path
+	}
+}
@@ -0,0 +1,265 @@
+package fastgocaptcha
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StatsWindow 是 Stats 统计的时间窗口，按分钟分桶
+	StatsWindow = 15 * time.Minute
+
+	statsBucketWidth = time.Minute
+	statsBucketCount = int(StatsWindow / statsBucketWidth)
+	// 每个桶中每个维度最多记录的 key 数量，超过的计入 statsOtherKey，防止攻击时内存无限增长
+	statsMaxKeys   = 1000
+	statsMaxKeyLen = 200
+	statsOtherKey  = "(other)"
+	statsTopN      = 10
+)
+
+type statsBucket struct {
+	start time.Time
+
+	challenges  uint64
+	successes   uint64
+	failures    uint64
+	bypasses    uint64
+	rateLimited uint64
+	banned      uint64
+	solveTime   time.Duration
+
+	generated        uint64
+	generationErrors uint64
+	generationTime   time.Duration
+
+	reasons    map[string]uint64
+	paths      map[string]uint64
+	failingIPs map[string]uint64
+}
+
+// captchaStats 按分钟保存最近 StatsWindow 内的事件计数，供 Stats 和管理面板使用
+type captchaStats struct {
+	mutex   sync.Mutex
+	buckets [statsBucketCount]statsBucket
+}
+
+func newCaptchaStats() *captchaStats {
+	return &captchaStats{}
+}
+
+func (s *captchaStats) bucketAt(start time.Time) *statsBucket {
+	return &s.buckets[int(start.Unix()/int64(statsBucketWidth/time.Second))%statsBucketCount]
+}
+
+// bucket 返回 now 所在的桶，桶已经属于更早的分钟时先清空，调用方需要持有锁
+func (s *captchaStats) bucket(now time.Time) *statsBucket {
+	start := now.Truncate(statsBucketWidth)
+	b := s.bucketAt(start)
+	if !b.start.Equal(start) {
+		*b = statsBucket{start: start}
+	}
+	return b
+}
+
+func countKey(m *map[string]uint64, key string) {
+	if key == "" {
+		return
+	}
+	if *m == nil {
+		*m = make(map[string]uint64)
+	}
+	if len(key) > statsMaxKeyLen {
+		key = key[:statsMaxKeyLen]
+	}
+	if _, ok := (*m)[key]; !ok && len(*m) >= statsMaxKeys {
+		key = statsOtherKey
+	}
+	(*m)[key]++
+}
+
+// record 根据生命周期事件更新统计
+func (s *captchaStats) record(e *Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := s.bucket(e.Time)
+	switch e.Type {
+	case EventChallengeIssued:
+		b.challenges++
+		countKey(&b.paths, e.Path)
+	case EventVerifySuccess:
+		b.successes++
+		b.solveTime += e.Latency
+	case EventVerifyFailure:
+		b.failures++
+		countKey(&b.reasons, e.Reason)
+		countKey(&b.failingIPs, e.ClientIP)
+	case EventBypass:
+		b.bypasses++
+	case EventRateLimited:
+		b.rateLimited++
+	case EventBanned:
+		b.banned++
+	}
+}
+
+func (s *captchaStats) recordGeneration(d time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	b := s.bucket(time.Now())
+	if err != nil {
+		b.generationErrors++
+		return
+	}
+	b.generated++
+	b.generationTime += d
+}
+
+// StatsCount 是某个 key 在统计窗口内的次数
+type StatsCount struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// StatsPoint 是一分钟内的计数
+type StatsPoint struct {
+	Time       time.Time `json:"time"`
+	Challenges uint64    `json:"challenges"`
+	Successes  uint64    `json:"successes"`
+	Failures   uint64    `json:"failures"`
+}
+
+// PoolStats 是验证码存储和生成的状态
+type PoolStats struct {
+	ActiveSessions int `json:"active_sessions"`
+	// OutstandingCaptchas 是内置存储中未使用的验证码数量，使用自定义存储时为 nil
+	OutstandingCaptchas *int   `json:"outstanding_captchas"`
+	Generated           uint64 `json:"generated"`
+	GenerationErrors    uint64 `json:"generation_errors"`
+	// GenerationAvgMS 是窗口内生成一张验证码的平均耗时（毫秒）
+	GenerationAvgMS float64 `json:"generation_avg_ms"`
+}
+
+// CaptchaStats 是最近 StatsWindow 内的运行状态
+type CaptchaStats struct {
+	Time   time.Time `json:"time"`
+	Window Duration  `json:"window"`
+
+	Challenges  uint64 `json:"challenges"`
+	Successes   uint64 `json:"successes"`
+	Failures    uint64 `json:"failures"`
+	Bypasses    uint64 `json:"bypasses"`
+	RateLimited uint64 `json:"rate_limited"`
+	Banned      uint64 `json:"banned"`
+	// SolveRate 是校验成功占全部校验的比例，没有校验时为 0
+	SolveRate       float64 `json:"solve_rate"`
+	AvgSolveSeconds float64 `json:"avg_solve_seconds"`
+
+	FailureReasons []StatsCount `json:"failure_reasons"`
+	TopPaths       []StatsCount `json:"top_paths"`
+	TopFailingIPs  []StatsCount `json:"top_failing_ips"`
+	// Timeline 按时间顺序列出每分钟的计数，最后一项是当前分钟
+	Timeline []StatsPoint `json:"timeline"`
+
+	Pool       PoolStats `json:"pool"`
+	ActiveBans int       `json:"active_bans"`
+}
+
+func topCounts(m map[string]uint64, n int) []StatsCount {
+	counts := make([]StatsCount, 0, len(m))
+	for key, count := range m {
+		counts = append(counts, StatsCount{Key: key, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+func (s *captchaStats) snapshot(now time.Time) *CaptchaStats {
+	stats := &CaptchaStats{
+		Time:     now,
+		Window:   Duration(StatsWindow),
+		Timeline: make([]StatsPoint, 0, statsBucketCount),
+	}
+	reasons := make(map[string]uint64)
+	paths := make(map[string]uint64)
+	failingIPs := make(map[string]uint64)
+	var solveTime, generationTime time.Duration
+
+	current := now.Truncate(statsBucketWidth)
+	s.mutex.Lock()
+	for i := statsBucketCount - 1; i >= 0; i-- {
+		start := current.Add(-time.Duration(i) * statsBucketWidth)
+		point := StatsPoint{Time: start}
+		if b := s.bucketAt(start); b.start.Equal(start) {
+			point.Challenges, point.Successes, point.Failures = b.challenges, b.successes, b.failures
+			stats.Challenges += b.challenges
+			stats.Successes += b.successes
+			stats.Failures += b.failures
+			stats.Bypasses += b.bypasses
+			stats.RateLimited += b.rateLimited
+			stats.Banned += b.banned
+			stats.Pool.Generated += b.generated
+			stats.Pool.GenerationErrors += b.generationErrors
+			solveTime += b.solveTime
+			generationTime += b.generationTime
+			for key, count := range b.reasons {
+				reasons[key] += count
+			}
+			for key, count := range b.paths {
+				paths[key] += count
+			}
+			for key, count := range b.failingIPs {
+				failingIPs[key] += count
+			}
+		}
+		stats.Timeline = append(stats.Timeline, point)
+	}
+	s.mutex.Unlock()
+
+	if verifications := stats.Successes + stats.Failures; verifications > 0 {
+		stats.SolveRate = float64(stats.Successes) / float64(verifications)
+	}
+	if stats.Successes > 0 {
+		stats.AvgSolveSeconds = solveTime.Seconds() / float64(stats.Successes)
+	}
+	if stats.Pool.Generated > 0 {
+		stats.Pool.GenerationAvgMS = float64(generationTime.Microseconds()) / 1000 / float64(stats.Pool.Generated)
+	}
+	stats.FailureReasons = topCounts(reasons, 0)
+	stats.TopPaths = topCounts(paths, statsTopN)
+	stats.TopFailingIPs = topCounts(failingIPs, statsTopN)
+	return stats
+}
+
+// activeSessions 返回未过期的会话数量
+func (f *FastGoCaptcha) activeSessions() int {
+	now := time.Now()
+	var sessions int
+	f.sessionManager.Range(func(key, value any) bool {
+		if session, ok := value.(*FastGoCaptchaSession); ok && !session.expired(now) {
+			sessions++
+		}
+		return true
+	})
+	return sessions
+}
+
+// Stats 返回最近 StatsWindow 内的挑战、校验、失败原因、被挑战最多的路径、失败最多的 IP，以及验证码存储的状态
+func (f *FastGoCaptcha) Stats() *CaptchaStats {
+	stats := f.stats.snapshot(time.Now())
+	stats.Pool.ActiveSessions = f.activeSessions()
+	if count := f.outstandingCaptchas(); count >= 0 {
+		stats.Pool.OutstandingCaptchas = &count
+	}
+	stats.ActiveBans = len(f.Bans())
+	return stats
+}
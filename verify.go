@@ -0,0 +1,139 @@
+package fastgocaptcha
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const defaultVerifyMaxBodySize = 64 << 10
+
+// WithVerifyMaxBodySize 限制 /fastgocaptcha/verify 请求体的大小，默认 64KB
+func WithVerifyMaxBodySize(size int64) FastGoCaptchaOption {
+	return func(f *FastGoCaptcha) {
+		f.verifyMaxBodySize = size
+	}
+}
+
+// verifyRequest 是解析并校验过格式的 /fastgocaptcha/verify 请求
+type verifyRequest struct {
+	ID        string
+	X         float64
+	ReturnTo  string
+	CSRFToken string
+}
+
+// verifyX 在 JSON 中同时接受数字和字符串形式的 x
+type verifyX string
+
+func (x *verifyX) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*x = verifyX(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errors.New("x must be a number or a numeric string")
+	}
+	*x = verifyX(n)
+	return nil
+}
+
+func (f *FastGoCaptcha) parseVerifyRequest(w http.ResponseWriter, r *http.Request) (*verifyRequest, *captchaError) {
+	r.Body = http.MaxBytesReader(w, r.Body, f.verifyMaxBodySize)
+
+	var id, x string
+	req := &verifyRequest{}
+	contentType := strings.ToLower(r.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"), strings.HasPrefix(contentType, "multipart/form-data"):
+		var err error
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			err = r.ParseMultipartForm(f.verifyMaxBodySize)
+		} else {
+			err = r.ParseForm()
+		}
+		if err != nil {
+			return nil, bodyError(err, "failed to parse form")
+		}
+		id = r.PostFormValue("id")
+		x = r.PostFormValue("x")
+		req.ReturnTo = r.FormValue("return_to")
+		req.CSRFToken = r.PostFormValue(csrfField)
+	case strings.HasPrefix(contentType, "application/json"), strings.HasPrefix(contentType, "text/json"), strings.HasPrefix(contentType, "application/x-json"):
+		var data struct {
+			ID        string  `json:"id"`
+			X         verifyX `json:"x"`
+			ReturnTo  string  `json:"return_to"`
+			CSRFToken string  `json:"csrf_token"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&data); err != nil {
+			return nil, bodyError(err, "failed to parse json body")
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			return nil, newError(http.StatusBadRequest, ErrMalformed, "unexpected data after json body")
+		}
+		id = data.ID
+		x = string(data.X)
+		req.ReturnTo = data.ReturnTo
+		req.CSRFToken = data.CSRFToken
+		if req.ReturnTo == "" {
+			req.ReturnTo = r.URL.Query().Get("return_to")
+		}
+	default:
+		return nil, newError(http.StatusUnsupportedMediaType, ErrUnsupportedMediaType, "unsupported content type: %s", contentType)
+	}
+
+	// 只接受服务端生成的标准格式 UUID
+	id = strings.TrimSpace(id)
+	if len(id) != 36 || uuid.Validate(id) != nil {
+		return nil, newError(http.StatusBadRequest, ErrInvalidID, "invalid captcha id")
+	}
+	req.ID = id
+
+	value, e := parseX(x)
+	if e != nil {
+		return nil, e
+	}
+	req.X = value
+	return req, nil
+}
+
+// parseX 解析客户端提交的 x，只接受非负的有限数字
+func parseX(x string) (float64, *captchaError) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		return 0, newError(http.StatusBadRequest, ErrInvalidX, "invalid x value")
+	}
+	return value, nil
+}
+
+func bodyError(err error, message string) *captchaError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return newError(http.StatusRequestEntityTooLarge, ErrBodyTooLarge, "request body exceeds %d bytes", maxBytesErr.Limit)
+	}
+	return newError(http.StatusBadRequest, ErrMalformed, "%s", message)
+}
+
+// checkX 检查 x 是否落在验证码图片范围内，并换算为整数像素
+func checkX(x float64, data *SlideBlockWrapper) (int, *captchaError) {
+	if data.imageWidth > 0 && x > float64(data.imageWidth) {
+		return 0, newError(http.StatusBadRequest, ErrInvalidX, "x is out of range [0, %d]", data.imageWidth)
+	}
+	return int(math.Round(x)), nil
+}